@@ -20,6 +20,9 @@ func main() {
 		WithDatabase().
 		WithMigrations().
 		WithUserRouter().
+		WithEnrichment().
+		WithPurge().
+		WithHealthRouter().
 		WithServer()
 
 	if err := builder.Build(); err != nil {
@@ -15,6 +15,129 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
+        "/admin/enrichment/requeue": {
+            "post": {
+                "description": "Ставит в очередь обогащения всех пользователей, у которых не заполнен возраст, пол или страна. Пользователи, уже находящиеся в очереди, пропускаются",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Повторное обогащение пользователей",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/dto.ResponseDTO"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "payload": {
+                                            "$ref": "#/definitions/dto.EnrichmentRequeuePayload"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorResponseDTO"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/quota": {
+            "get": {
+                "description": "Последнее известное состояние квоты каждого API по заголовкам X-Rate-Limit-*. При остатке не больше резерва запросы к API приостанавливаются до восстановления квоты",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Квоты публичных API",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/dto.ResponseDTO"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "payload": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/dto.QuotaPayload"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    }
+                }
+            }
+        },
+        "/health": {
+            "get": {
+                "description": "Проверка подключения к БД и состояния circuit breaker публичных API. При недоступной БД возвращается 503",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "health"
+                ],
+                "summary": "Состояние сервиса",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/dto.ResponseDTO"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "payload": {
+                                            "$ref": "#/definitions/dto.HealthPayload"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/dto.ResponseDTO"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "payload": {
+                                            "$ref": "#/definitions/dto.HealthPayload"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    }
+                }
+            }
+        },
         "/users": {
             "get": {
                 "description": "Получение списка пользователей с помощью передачи query параметров",
@@ -31,10 +154,15 @@ const docTemplate = `{
                 "parameters": [
                     {
                         "type": "integer",
-                        "description": "Номер страницы",
+                        "description": "Номер страницы (обязателен, если не передан cursor)",
                         "name": "page",
-                        "in": "query",
-                        "required": true
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Курсор для постраничного вывода без OFFSET: пустое значение - первая страница, далее next_cursor из ответа",
+                        "name": "cursor",
+                        "in": "query"
                     },
                     {
                         "type": "integer",
@@ -43,21 +171,39 @@ const docTemplate = `{
                         "in": "query",
                         "required": true
                     },
+                    {
+                        "type": "boolean",
+                        "description": "Считать ли общее количество записей (по умолчанию true для page и false для cursor)",
+                        "name": "with_total",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Включать ли удаленных пользователей, ожидающих окончательного удаления (по умолчанию false)",
+                        "name": "include_deleted",
+                        "in": "query"
+                    },
                     {
                         "type": "string",
-                        "description": "Имя пользователя",
+                        "description": "Поисковая строка по имени, фамилии и отчеству (префикс, подстрока, нечеткое совпадение). Без order_by в режиме page результаты сортируются по релевантности",
+                        "name": "q",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Имя пользователя в исходном написании или в транслитерации",
                         "name": "name",
                         "in": "query"
                     },
                     {
                         "type": "string",
-                        "description": "Фамилия пользователя",
+                        "description": "Фамилия пользователя в исходном написании или в транслитерации",
                         "name": "surname",
                         "in": "query"
                     },
                     {
                         "type": "string",
-                        "description": "Отчество пользователя",
+                        "description": "Отчество пользователя в исходном написании или в транслитерации",
                         "name": "patronymic",
                         "in": "query"
                     },
@@ -68,17 +214,89 @@ const docTemplate = `{
                         "in": "query"
                     },
                     {
-                        "type": "string",
-                        "description": "Пол пользователя",
+                        "type": "integer",
+                        "description": "Минимальный возраст пользователя (включительно)",
+                        "name": "age_min",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Максимальный возраст пользователя (включительно)",
+                        "name": "age_max",
+                        "in": "query"
+                    },
+                    {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        },
+                        "collectionFormat": "csv",
+                        "description": "Пол пользователя, можно передать несколько значений",
                         "name": "gender",
                         "in": "query"
                     },
                     {
-                        "type": "string",
-                        "description": "Код страны пользователя",
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        },
+                        "collectionFormat": "csv",
+                        "description": "Код страны пользователя, можно передать несколько значений",
                         "name": "country_id",
                         "in": "query"
                     },
+                    {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        },
+                        "collectionFormat": "csv",
+                        "description": "Статус обогащения: pending, done, incomplete, needs_review, failed",
+                        "name": "enrichment_status",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Минимальный размер выборки, по которой предсказан возраст",
+                        "name": "min_age_count",
+                        "in": "query"
+                    },
+                    {
+                        "type": "number",
+                        "description": "Минимальная вероятность предсказанного пола (0..1)",
+                        "name": "min_gender_probability",
+                        "in": "query"
+                    },
+                    {
+                        "type": "number",
+                        "description": "Минимальная вероятность предсказанной страны (0..1)",
+                        "name": "min_country_probability",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Дата создания от (RFC3339 или YYYY-MM-DD)",
+                        "name": "created_from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Дата создания до включительно (RFC3339 или YYYY-MM-DD)",
+                        "name": "created_to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Дата обновления от (RFC3339 или YYYY-MM-DD)",
+                        "name": "updated_from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Дата обновления до включительно (RFC3339 или YYYY-MM-DD)",
+                        "name": "updated_to",
+                        "in": "query"
+                    },
                     {
                         "type": "string",
                         "description": "Поле для сортировки",
@@ -109,6 +327,12 @@ const docTemplate = `{
                                     }
                                 }
                             ]
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Слабый ETag страницы, меняется при изменении любого пользователя на ней"
+                            }
                         }
                     },
                     "400": {
@@ -126,7 +350,7 @@ const docTemplate = `{
                 }
             },
             "post": {
-                "description": "Создание пользователя, данные будут обогащены с помощью публичных API",
+                "description": "Создание пользователя. ФИО нормализуется (пробелы, регистр, NFC) и сохраняется также в латинской транслитерации (ICAO), по которой запрашиваются предсказания. Возраст, пол и страна заполняются асинхронно с помощью публичных API, статус виден в поле enrichment_status. Переданные при создании age, gender и country_id сохраняются как импортированные и обогащением не перезаписываются",
                 "consumes": [
                     "application/json"
                 ],
@@ -161,6 +385,34 @@ const docTemplate = `{
                         "description": "Отчество пользователя",
                         "name": "patronymic",
                         "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "reject",
+                            "link"
+                        ],
+                        "type": "string",
+                        "description": "Поведение при найденном пользователе с тем же ФИО: reject (по умолчанию) - ошибка 409 с existing_uuid, link - создать со ссылкой duplicate_of",
+                        "name": "on_duplicate",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Искать дубликаты по похожим, а не только совпадающим ФИО",
+                        "name": "fuzzy",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "no-cache - не использовать сохраненные ответы публичных API",
+                        "name": "Cache-Control",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Ключ идемпотентности: повтор запроса с тем же ключом возвращает исходный ответ вместо создания нового пользователя",
+                        "name": "Idempotency-Key",
+                        "in": "header"
                     }
                 ],
                 "responses": {
@@ -180,6 +432,12 @@ const docTemplate = `{
                                     }
                                 }
                             ]
+                        },
+                        "headers": {
+                            "Idempotent-Replayed": {
+                                "type": "string",
+                                "description": "true, если ответ повторен по Idempotency-Key"
+                            }
                         }
                     },
                     "400": {
@@ -188,6 +446,18 @@ const docTemplate = `{
                             "$ref": "#/definitions/dto.ErrorResponseDTO"
                         }
                     },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorResponseDTO"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorResponseDTO"
+                        }
+                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
@@ -197,9 +467,9 @@ const docTemplate = `{
                 }
             }
         },
-        "/users/{uuid}": {
-            "delete": {
-                "description": "Удаление пользователя по переданному ID",
+        "/users/batch": {
+            "post": {
+                "description": "Создание списка пользователей одним запросом. Пользователи сохраняются одной транзакцией и ставятся в очередь обогащения, где имена дедуплицируются и обогащаются пакетными запросами к публичным API. Невалидные элементы не прерывают обработку и возвращаются с текстом ошибки. Точные дубликаты существующих пользователей и повторы ФИО внутри пакета по умолчанию не создаются и возвращаются с existing_uuid",
                 "consumes": [
                     "application/json"
                 ],
@@ -209,21 +479,66 @@ const docTemplate = `{
                 "tags": [
                     "users"
                 ],
-                "summary": "Удаление пользователя",
+                "summary": "Пакетное создание пользователей",
                 "parameters": [
                     {
+                        "description": "Список пользователей",
+                        "name": "users",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/dto.UserCreateDTO"
+                            }
+                        }
+                    },
+                    {
+                        "enum": [
+                            "reject",
+                            "link"
+                        ],
                         "type": "string",
-                        "description": "ID пользователя",
-                        "name": "uuid",
-                        "in": "path",
-                        "required": true
+                        "description": "Поведение при найденном пользователе с тем же ФИО: reject (по умолчанию) - элемент не создается и возвращается с existing_uuid, link - создать со ссылкой duplicate_of",
+                        "name": "on_duplicate",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "no-cache - не использовать сохраненные ответы публичных API",
+                        "name": "Cache-Control",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Ключ идемпотентности: повтор запроса с тем же ключом возвращает исходный ответ вместо повторного создания",
+                        "name": "Idempotency-Key",
+                        "in": "header"
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/dto.EmptyResponseDTO"
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/dto.ResponseDTO"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "payload": {
+                                            "$ref": "#/definitions/dto.UserBatchCreatePayload"
+                                        }
+                                    }
+                                }
+                            ]
+                        },
+                        "headers": {
+                            "Idempotent-Replayed": {
+                                "type": "string",
+                                "description": "true, если ответ повторен по Idempotency-Key"
+                            }
                         }
                     },
                     "400": {
@@ -232,8 +547,14 @@ const docTemplate = `{
                             "$ref": "#/definitions/dto.ErrorResponseDTO"
                         }
                     },
-                    "404": {
-                        "description": "Not Found",
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorResponseDTO"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
                         "schema": {
                             "$ref": "#/definitions/dto.ErrorResponseDTO"
                         }
@@ -245,9 +566,11 @@ const docTemplate = `{
                         }
                     }
                 }
-            },
-            "patch": {
-                "description": "Обновление данных пользователя (в теле запроса нет обязательных полей, но в случае передачи пустого тела запроса будет возвращен ответ с кодом 400)",
+            }
+        },
+        "/users/{uuid}": {
+            "get": {
+                "description": "Получение данных пользователя по переданному ID",
                 "consumes": [
                     "application/json"
                 ],
@@ -257,7 +580,7 @@ const docTemplate = `{
                 "tags": [
                     "users"
                 ],
-                "summary": "Обновление данных пользователя",
+                "summary": "Получение пользователя",
                 "parameters": [
                     {
                         "type": "string",
@@ -265,24 +588,226 @@ const docTemplate = `{
                         "name": "uuid",
                         "in": "path",
                         "required": true
-                    },
-                    {
-                        "description": "Имя пользователя",
-                        "name": "name",
-                        "in": "body",
-                        "schema": {
-                            "type": "string"
-                        }
-                    },
-                    {
-                        "description": "Фамилия пользователя",
-                        "name": "surname",
-                        "in": "body",
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
                         "schema": {
-                            "type": "string"
-                        }
-                    },
-                    {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/dto.ResponseDTO"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "payload": {
+                                            "$ref": "#/definitions/dto.UserPayload"
+                                        }
+                                    }
+                                }
+                            ]
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Версия пользователя для If-Match"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorResponseDTO"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorResponseDTO"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorResponseDTO"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "description": "Полная замена изменяемых данных пользователя: необязательные поля, отсутствующие в теле запроса, очищаются",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "users"
+                ],
+                "summary": "Замена данных пользователя",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID пользователя",
+                        "name": "uuid",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Новые данные пользователя",
+                        "name": "user",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/dto.UserReplaceDTO"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag пользователя: замена применяется, только если пользователь не менялся с момента получения",
+                        "name": "If-Match",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/dto.EmptyResponseDTO"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Новая версия пользователя"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorResponseDTO"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorResponseDTO"
+                        }
+                    },
+                    "412": {
+                        "description": "Precondition Failed",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorResponseDTO"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorResponseDTO"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Удаление пользователя по переданному ID. Пользователь скрывается и может быть восстановлен до окончательного удаления по истечении срока хранения",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "users"
+                ],
+                "summary": "Удаление пользователя",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID пользователя",
+                        "name": "uuid",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag пользователя: удаление выполняется, только если пользователь не менялся с момента получения",
+                        "name": "If-Match",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/dto.EmptyResponseDTO"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorResponseDTO"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorResponseDTO"
+                        }
+                    },
+                    "412": {
+                        "description": "Precondition Failed",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorResponseDTO"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorResponseDTO"
+                        }
+                    }
+                }
+            },
+            "patch": {
+                "description": "Обновление данных пользователя в формате JSON Merge Patch (RFC 7396): отсутствующие поля не меняются, null очищает поле (кроме name и surname). В теле запроса нет обязательных полей, но в случае передачи пустого тела запроса будет возвращен ответ с кодом 400",
+                "consumes": [
+                    "application/json",
+                    "application/merge-patch+json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "users"
+                ],
+                "summary": "Обновление данных пользователя",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID пользователя",
+                        "name": "uuid",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Имя пользователя",
+                        "name": "name",
+                        "in": "body",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    {
+                        "description": "Фамилия пользователя",
+                        "name": "surname",
+                        "in": "body",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    {
                         "description": "Отчество пользователя",
                         "name": "patronymic",
                         "in": "body",
@@ -307,12 +832,237 @@ const docTemplate = `{
                         }
                     },
                     {
-                        "description": "Код страны пользователя",
-                        "name": "country_id",
-                        "in": "body",
-                        "schema": {
-                            "type": "string"
-                        }
+                        "description": "Код страны пользователя",
+                        "name": "country_id",
+                        "in": "body",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag пользователя: изменение применяется, только если пользователь не менялся с момента получения",
+                        "name": "If-Match",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/dto.EmptyResponseDTO"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Новая версия пользователя"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorResponseDTO"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorResponseDTO"
+                        }
+                    },
+                    "412": {
+                        "description": "Precondition Failed",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorResponseDTO"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorResponseDTO"
+                        }
+                    }
+                }
+            }
+        },
+        "/users/{uuid}/history": {
+            "get": {
+                "description": "Получение всех изменений пользователя (создание, обновления, удаление) в порядке применения, в том числе для удаленного пользователя",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "users"
+                ],
+                "summary": "История изменений пользователя",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID пользователя",
+                        "name": "uuid",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/dto.ResponseDTO"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "payload": {
+                                            "$ref": "#/definitions/dto.UserHistoryPayload"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorResponseDTO"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorResponseDTO"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorResponseDTO"
+                        }
+                    }
+                }
+            }
+        },
+        "/users/{uuid}/merge": {
+            "post": {
+                "description": "Слияние пользователя-дубликата source_uuid с пользователем из пути. Отчество, возраст, пол и страна переносятся по правилам prefer вместе с достоверностью и происхождением, по умолчанию - только незаполненные. Дубликат удаляется со ссылкой duplicate_of, история изменений обоих пользователей сохраняется",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "users"
+                ],
+                "summary": "Слияние пользователей",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID пользователя, в которого выполняется слияние",
+                        "name": "uuid",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Параметры слияния",
+                        "name": "merge",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/dto.UserMergeDTO"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag пользователя из пути: слияние выполняется, только если пользователь не менялся с момента получения",
+                        "name": "If-Match",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/dto.ResponseDTO"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "payload": {
+                                            "$ref": "#/definitions/dto.UserPayload"
+                                        }
+                                    }
+                                }
+                            ]
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Новая версия пользователя"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorResponseDTO"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorResponseDTO"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorResponseDTO"
+                        }
+                    },
+                    "412": {
+                        "description": "Precondition Failed",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorResponseDTO"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorResponseDTO"
+                        }
+                    }
+                }
+            }
+        },
+        "/users/{uuid}/restore": {
+            "post": {
+                "description": "Восстановление удаленного пользователя, который еще не был удален окончательно",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "users"
+                ],
+                "summary": "Восстановление пользователя",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID пользователя",
+                        "name": "uuid",
+                        "in": "path",
+                        "required": true
                     }
                 ],
                 "responses": {
@@ -345,6 +1095,21 @@ const docTemplate = `{
         }
     },
     "definitions": {
+        "dto.CountryProbabilityPayload": {
+            "type": "object",
+            "properties": {
+                "country_id": {
+                    "description": "Строковый ID страны",
+                    "type": "string",
+                    "example": "RU"
+                },
+                "probability": {
+                    "description": "Вероятность от 0 до 1",
+                    "type": "number",
+                    "example": 0.87
+                }
+            }
+        },
         "dto.EmptyResponseDTO": {
             "type": "object",
             "properties": {
@@ -355,12 +1120,60 @@ const docTemplate = `{
                 }
             }
         },
+        "dto.EnrichmentRequeuePayload": {
+            "type": "object",
+            "properties": {
+                "queued": {
+                    "description": "Количество пользователей, поставленных в очередь",
+                    "type": "integer",
+                    "example": 42
+                }
+            }
+        },
+        "dto.ErrorDetailPayload": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "description": "Машиночитаемый код ошибки поля",
+                    "type": "string",
+                    "example": "invalid_value"
+                },
+                "field": {
+                    "description": "Название поля",
+                    "type": "string",
+                    "example": "gender"
+                },
+                "message": {
+                    "description": "Текст ошибки поля",
+                    "type": "string",
+                    "example": "must be one of: male, female"
+                }
+            }
+        },
         "dto.ErrorPayload": {
             "type": "object",
             "properties": {
+                "code": {
+                    "description": "Машиночитаемый код ошибки",
+                    "type": "string",
+                    "example": "validation_failed"
+                },
+                "details": {
+                    "description": "Ошибки отдельных полей запроса",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/dto.ErrorDetailPayload"
+                    }
+                },
                 "message": {
                     "description": "Текст ошибки",
-                    "type": "string"
+                    "type": "string",
+                    "example": "request validation failed"
+                },
+                "meta": {
+                    "description": "Дополнительные сведения, например existing_uuid для code=duplicate",
+                    "type": "object",
+                    "additionalProperties": true
                 }
             }
         },
@@ -376,11 +1189,58 @@ const docTemplate = `{
                 }
             }
         },
+        "dto.FieldProvenancePayload": {
+            "type": "object",
+            "properties": {
+                "kind": {
+                    "description": "predicted - предсказано API, manual - задано вручную, imported - передано при создании",
+                    "type": "string",
+                    "example": "manual"
+                },
+                "set_at": {
+                    "description": "Строковое представление даты установки значения",
+                    "type": "string",
+                    "example": "2006-01-02T15:04:05Z07:00"
+                },
+                "source": {
+                    "description": "Источник значения: название API для predicted, api для manual, import для imported",
+                    "type": "string",
+                    "example": "api"
+                }
+            }
+        },
+        "dto.HealthPayload": {
+            "type": "object",
+            "properties": {
+                "database": {
+                    "description": "Состояние подключения к БД",
+                    "type": "string",
+                    "example": "ok"
+                },
+                "predictors": {
+                    "description": "Состояние circuit breaker каждого API: closed, open, half_open",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "status": {
+                    "description": "ok, degraded (недоступен один из API) или down (недоступна БД)",
+                    "type": "string",
+                    "example": "ok"
+                }
+            }
+        },
         "dto.ListOfUsersPayload": {
             "type": "object",
             "properties": {
+                "next_cursor": {
+                    "description": "Курсор следующей страницы (только в режиме курсорной пагинации, отсутствует на последней странице)",
+                    "type": "string",
+                    "example": "eyJvIjoiY3JlYXRlZF9hdCJ9"
+                },
                 "total": {
-                    "description": "Общее количество записей с переданными фильтрами",
+                    "description": "Общее количество записей с переданными фильтрами (отсутствует при with_total=false)",
                     "type": "integer",
                     "example": 0
                 },
@@ -393,6 +1253,46 @@ const docTemplate = `{
                 }
             }
         },
+        "dto.QuotaPayload": {
+            "type": "object",
+            "properties": {
+                "limit": {
+                    "description": "Размер квоты на окно",
+                    "type": "integer",
+                    "example": 1000
+                },
+                "provider": {
+                    "description": "Название API",
+                    "type": "string",
+                    "example": "agify"
+                },
+                "remaining": {
+                    "description": "Остаток квоты, не передается, пока API не сообщил квоту",
+                    "type": "integer",
+                    "example": 120
+                },
+                "reserve": {
+                    "description": "Резерв, который не расходуется клиентом",
+                    "type": "integer",
+                    "example": 100
+                },
+                "reset_at": {
+                    "description": "Время восстановления квоты",
+                    "type": "string",
+                    "example": "2025-01-02T00:00:00Z"
+                },
+                "throttled": {
+                    "description": "Запросы к API приостановлены до восстановления квоты",
+                    "type": "boolean",
+                    "example": false
+                },
+                "updated_at": {
+                    "description": "Время последнего ответа с квотой",
+                    "type": "string",
+                    "example": "2025-01-01T12:00:00Z"
+                }
+            }
+        },
         "dto.ResponseDTO": {
             "type": "object",
             "properties": {
@@ -406,9 +1306,143 @@ const docTemplate = `{
                 }
             }
         },
+        "dto.UserBatchCreatePayload": {
+            "type": "object",
+            "properties": {
+                "created": {
+                    "description": "Количество созданных пользователей",
+                    "type": "integer",
+                    "example": 1
+                },
+                "failed": {
+                    "description": "Количество пользователей, не прошедших валидацию или отклоненных как дубликаты",
+                    "type": "integer",
+                    "example": 0
+                },
+                "results": {
+                    "description": "Результаты в порядке переданного массива",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/dto.UserBatchItemPayload"
+                    }
+                }
+            }
+        },
+        "dto.UserBatchItemPayload": {
+            "type": "object",
+            "properties": {
+                "details": {
+                    "description": "Ошибки отдельных полей пользователя",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/dto.ErrorDetailPayload"
+                    }
+                },
+                "duplicate_of": {
+                    "description": "ID найденного дубликата, с которым связан пользователь (при on_duplicate=link)",
+                    "type": "string",
+                    "example": "7c460676-8870-3bdc-b602-1edf5125d73a"
+                },
+                "error": {
+                    "description": "Причина, по которой пользователь не был создан",
+                    "type": "string",
+                    "example": "surname: must not be empty"
+                },
+                "existing_uuid": {
+                    "description": "ID существующего пользователя с тем же ФИО, из-за которого пользователь не был создан",
+                    "type": "string",
+                    "example": "7c460676-8870-3bdc-b602-1edf5125d73a"
+                },
+                "index": {
+                    "description": "Позиция пользователя в переданном массиве",
+                    "type": "integer",
+                    "example": 0
+                },
+                "uuid": {
+                    "description": "ID созданного пользователя",
+                    "type": "string",
+                    "example": "8d571787-9981-4add-a713-2fde6236e84b"
+                }
+            }
+        },
+        "dto.UserChangePayload": {
+            "type": "object",
+            "properties": {
+                "changed_at": {
+                    "description": "Строковое представление даты изменения",
+                    "type": "string",
+                    "example": "2006-01-02T15:04:05Z07:00"
+                },
+                "id": {
+                    "description": "Порядковый номер изменения",
+                    "type": "integer",
+                    "example": 1
+                },
+                "new": {
+                    "description": "Значения после изменения (для UPDATE - только изменившиеся поля)",
+                    "type": "object",
+                    "additionalProperties": true
+                },
+                "old": {
+                    "description": "Значения до изменения (для UPDATE - только изменившиеся поля)",
+                    "type": "object",
+                    "additionalProperties": true
+                },
+                "operation": {
+                    "description": "Операция: INSERT, UPDATE, DELETE",
+                    "type": "string",
+                    "example": "UPDATE"
+                },
+                "request_id": {
+                    "description": "ID запроса, в рамках которого произошло изменение (отсутствует для фонового обогащения)",
+                    "type": "string",
+                    "example": "cr3vq1hd0cvs73a0b6a0"
+                }
+            }
+        },
+        "dto.UserCreateDTO": {
+            "type": "object",
+            "properties": {
+                "age": {
+                    "description": "Известный возраст пользователя, не перезаписывается обогащением",
+                    "type": "integer",
+                    "example": 22
+                },
+                "country_id": {
+                    "description": "Известная страна пользователя, не перезаписывается обогащением",
+                    "type": "string",
+                    "example": "RU"
+                },
+                "gender": {
+                    "description": "Известный пол пользователя, не перезаписывается обогащением",
+                    "type": "string",
+                    "example": "male"
+                },
+                "name": {
+                    "description": "Имя пользователя",
+                    "type": "string",
+                    "example": "Dmitriy"
+                },
+                "patronymic": {
+                    "description": "Отчество пользователя (необязательное поле)",
+                    "type": "string",
+                    "example": "Vasilevich"
+                },
+                "surname": {
+                    "description": "Фамилия пользователя",
+                    "type": "string",
+                    "example": "Ushakov"
+                }
+            }
+        },
         "dto.UserCreatePayload": {
             "type": "object",
             "properties": {
+                "duplicate_of": {
+                    "description": "ID найденного дубликата, с которым связан пользователь (при on_duplicate=link)",
+                    "type": "string",
+                    "example": "7c460676-8870-3bdc-b602-1edf5125d73a"
+                },
                 "uuid": {
                     "description": "ID пользователя",
                     "type": "string",
@@ -416,6 +1450,35 @@ const docTemplate = `{
                 }
             }
         },
+        "dto.UserHistoryPayload": {
+            "type": "object",
+            "properties": {
+                "changes": {
+                    "description": "Изменения в порядке применения",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/dto.UserChangePayload"
+                    }
+                }
+            }
+        },
+        "dto.UserMergeDTO": {
+            "type": "object",
+            "properties": {
+                "prefer": {
+                    "description": "Откуда взять поле (patronymic, age, gender, country_id): target или source. По умолчанию из source берутся только поля, не заполненные у target",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "source_uuid": {
+                    "description": "ID пользователя-дубликата, который удаляется после слияния",
+                    "type": "string",
+                    "example": "8d571787-9981-4add-a713-2fde6236e84b"
+                }
+            }
+        },
         "dto.UserPayload": {
             "type": "object",
             "properties": {
@@ -424,40 +1487,161 @@ const docTemplate = `{
                     "type": "integer",
                     "example": 22
                 },
+                "age_count": {
+                    "description": "Размер выборки, по которой предсказан возраст",
+                    "type": "integer",
+                    "example": 1520
+                },
+                "countries": {
+                    "description": "Все предсказанные страны в порядке убывания вероятности",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/dto.CountryProbabilityPayload"
+                    }
+                },
+                "country_count": {
+                    "description": "Размер выборки, по которой предсказана страна",
+                    "type": "integer",
+                    "example": 1520
+                },
                 "country_id": {
                     "description": "Строковый ID страны пользователя",
                     "type": "string",
                     "example": "RU"
                 },
+                "country_probability": {
+                    "description": "Вероятность предсказанной страны",
+                    "type": "number",
+                    "example": 0.87
+                },
                 "created_at": {
                     "description": "Строковое представление даты создания пользователя",
                     "type": "string",
                     "example": "2006-01-02T15:04:05Z07:00"
                 },
+                "deleted_at": {
+                    "description": "Строковое представление даты удаления пользователя (только при include_deleted=true)",
+                    "type": "string",
+                    "example": "2006-01-02T15:04:05Z07:00"
+                },
+                "duplicate_of": {
+                    "description": "ID пользователя, дубликатом которого является этот (в том числе после слияния)",
+                    "type": "string",
+                    "example": "8d571787-9981-4add-a713-2fde6236e84b"
+                },
+                "enrichment_status": {
+                    "description": "Статус обогащения: pending, done, incomplete, needs_review, failed",
+                    "type": "string",
+                    "example": "done"
+                },
                 "gender": {
                     "description": "Пол пользователя",
                     "type": "string",
                     "example": "male"
                 },
+                "gender_count": {
+                    "description": "Размер выборки, по которой предсказан пол",
+                    "type": "integer",
+                    "example": 1520
+                },
+                "gender_probability": {
+                    "description": "Вероятность предсказанного пола",
+                    "type": "number",
+                    "example": 0.99
+                },
                 "name": {
                     "description": "Имя пользователя",
                     "type": "string",
                     "example": "Dmitriy"
                 },
+                "name_latin": {
+                    "description": "Имя пользователя в латинской транслитерации (ICAO)",
+                    "type": "string",
+                    "example": "Dmitrii"
+                },
                 "patronymic": {
                     "description": "Отчество пользователя",
                     "type": "string",
                     "example": "Vasilevich"
                 },
+                "patronymic_latin": {
+                    "description": "Отчество пользователя в латинской транслитерации (ICAO)",
+                    "type": "string",
+                    "example": "Vasilevich"
+                },
+                "provenance": {
+                    "description": "Происхождение значений age, gender и country_id",
+                    "type": "object",
+                    "additionalProperties": {
+                        "$ref": "#/definitions/dto.FieldProvenancePayload"
+                    }
+                },
+                "review_reasons": {
+                    "description": "Поля, предсказания для которых не прошли порог достоверности, и причины",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
                 "surname": {
                     "description": "Фамилия пользователя",
                     "type": "string",
                     "example": "Ushakov"
                 },
+                "surname_latin": {
+                    "description": "Фамилия пользователя в латинской транслитерации (ICAO)",
+                    "type": "string",
+                    "example": "Ushakov"
+                },
+                "updated_at": {
+                    "description": "Строковое представление даты последнего обновления пользователя",
+                    "type": "string",
+                    "example": "2006-01-02T15:04:05Z07:00"
+                },
                 "uuid": {
                     "description": "ID пользователя",
                     "type": "string",
                     "example": "8d571787-9981-4add-a713-2fde6236e84b"
+                },
+                "version": {
+                    "description": "Версия пользователя, совпадает со значением ETag",
+                    "type": "integer",
+                    "example": 3
+                }
+            }
+        },
+        "dto.UserReplaceDTO": {
+            "type": "object",
+            "properties": {
+                "age": {
+                    "description": "Возврат пользователя",
+                    "type": "integer",
+                    "example": 22
+                },
+                "country_id": {
+                    "description": "Строковый ID страны пользователя",
+                    "type": "string",
+                    "example": "RU"
+                },
+                "gender": {
+                    "description": "Пол пользователя",
+                    "type": "string",
+                    "example": "male"
+                },
+                "name": {
+                    "description": "Имя пользователя",
+                    "type": "string",
+                    "example": "Dmitriy"
+                },
+                "patronymic": {
+                    "description": "Отчество пользователя",
+                    "type": "string",
+                    "example": "Vasilevich"
+                },
+                "surname": {
+                    "description": "Фамилия пользователя",
+                    "type": "string",
+                    "example": "Ushakov"
                 }
             }
         }
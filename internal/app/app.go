@@ -3,11 +3,13 @@ package app
 import (
 	"context"
 	"database/sql"
+	"effective-mobile-test-task/internal/apperror"
 	"effective-mobile-test-task/internal/configs"
+	"effective-mobile-test-task/internal/enricher"
 	"effective-mobile-test-task/internal/handler"
-	"effective-mobile-test-task/internal/httpclient"
 	psqlImpl "effective-mobile-test-task/internal/repository/postgres"
 	"effective-mobile-test-task/internal/service"
+	"effective-mobile-test-task/internal/worker"
 	"net/http"
 	"os"
 	"os/signal"
@@ -22,13 +24,22 @@ import (
 	"github.com/rs/zerolog/hlog"
 )
 
-type AppBuilder struct {
-	logger zerolog.Logger
-	router *chi.Mux
-	server *http.Server
-	db     *sql.DB
-	err    error
-}
+type (
+	AppBuilder struct {
+		logger     zerolog.Logger
+		router     *chi.Mux
+		server     *http.Server
+		db         *sql.DB
+		predictors []handler.PredictorStatus
+		workers    []backgroundWorker
+		err        error
+	}
+	// backgroundWorker фоновый процесс, который работает до отмены контекста
+	backgroundWorker interface {
+		Start(ctx context.Context)
+		Wait()
+	}
+)
 
 func NewAppBuilder() *AppBuilder {
 	return &AppBuilder{}
@@ -106,42 +117,178 @@ func (b *AppBuilder) WithUserRouter() *AppBuilder {
 		return b.error(err)
 	}
 
-	agifyConfig, err := configs.GetAgifyConfig()
+	userService, err := service.NewUserService(userRepo)
+	if err != nil {
+		return b.error(err)
+	}
+
+	idempotencyRepo, err := psqlImpl.NewIdempotencyRepo(b.db)
 	if err != nil {
 		return b.error(err)
 	}
-	genderizeConfig, err := configs.GetGenderizeConfig()
+	idempotencyConfig, err := configs.GetIdempotencyConfig()
 	if err != nil {
 		return b.error(err)
 	}
-	nationalizeConfig, err := configs.GetNationalizeConfig()
+	idempotencyService, err := service.NewIdempotencyService(idempotencyRepo, *idempotencyConfig)
 	if err != nil {
 		return b.error(err)
 	}
 
-	agifyClient, err := httpclient.NewPredictorClient[httpclient.AgifyResponse](*agifyConfig)
+	userHandler, err := handler.NewUserHandler(userService, idempotencyService)
 	if err != nil {
 		return b.error(err)
 	}
-	genderizeClient, err := httpclient.NewPredictorClient[httpclient.GenderizeResponse](*genderizeConfig)
+
+	b.router.Mount("/users", userHandler.Routes())
+	return b
+}
+
+func (b *AppBuilder) WithPurge() *AppBuilder {
+	if b.err != nil {
+		return b
+	}
+	userRepo, err := psqlImpl.NewUserRepo(b.db)
 	if err != nil {
 		return b.error(err)
 	}
-	nationalizeClient, err := httpclient.NewPredictorClient[httpclient.NationalizeResponse](*nationalizeConfig)
+	idempotencyRepo, err := psqlImpl.NewIdempotencyRepo(b.db)
 	if err != nil {
 		return b.error(err)
 	}
 
-	userService, err := service.NewUserService(userRepo, agifyClient, genderizeClient, nationalizeClient)
+	purgeConfig, err := configs.GetPurgeWorkerConfig()
 	if err != nil {
 		return b.error(err)
 	}
-	userHandler, err := handler.NewUserHandler(userService)
+	purgeWorker, err := worker.NewPurgeWorker(*purgeConfig, userRepo, idempotencyRepo, b.logger)
 	if err != nil {
 		return b.error(err)
 	}
 
-	b.router.Mount("/users", userHandler.Routes())
+	b.workers = append(b.workers, purgeWorker)
+	return b
+}
+
+func (b *AppBuilder) WithEnrichment() *AppBuilder {
+	if b.err != nil {
+		return b
+	}
+	userRepo, err := psqlImpl.NewUserRepo(b.db)
+	if err != nil {
+		return b.error(err)
+	}
+	jobRepo, err := psqlImpl.NewEnrichmentJobRepo(b.db)
+	if err != nil {
+		return b.error(err)
+	}
+
+	offlineConfig, err := configs.GetOfflineEnricherConfig()
+	if err != nil {
+		return b.error(err)
+	}
+	if err = offlineConfig.Validate(); err != nil {
+		return b.error(apperror.NewAppError("WithEnrichment", "invalid offline enricher config", err))
+	}
+
+	cacheRepo, err := psqlImpl.NewPredictorCacheRepo(b.db)
+	if err != nil {
+		return b.error(err)
+	}
+	cacheConfig, err := configs.GetPredictorCacheConfig()
+	if err != nil {
+		return b.error(err)
+	}
+
+	// при основном офлайн-источнике API без ключа не подключается, и сервис может работать полностью офлайн
+	apis := &predictorAPIs{
+		cacheConfig: *cacheConfig,
+		cacheRepo:   cacheRepo,
+		optional:    offlineConfig.Mode == enricher.OfflinePrimary,
+		logger:      b.logger,
+	}
+	if err = addPredictorAPI(apis, configs.GetAgifyConfig, enricher.NewAgifyEnricher); err != nil {
+		return b.error(err)
+	}
+	if err = addPredictorAPI(apis, configs.GetGenderizeConfig, enricher.NewGenderizeEnricher); err != nil {
+		return b.error(err)
+	}
+	if err = addPredictorAPI(apis, configs.GetNationalizeConfig, enricher.NewNationalizeEnricher); err != nil {
+		return b.error(err)
+	}
+	quotas := make([]handler.QuotaReporter, 0, len(apis.clients))
+	for _, client := range apis.clients {
+		b.predictors = append(b.predictors, client)
+		quotas = append(quotas, client)
+	}
+
+	// основной офлайн-источник опрашивается до API, и API получают только имена, по которым
+	// он не дал значений; резервный - после API по полям, которые остались незаполненными
+	stages := [][]enricher.Enricher{}
+	if len(apis.enrichers) > 0 {
+		stages = append(stages, apis.enrichers)
+	}
+	if offlineConfig.Mode != enricher.OfflineDisabled {
+		offline, err := enricher.LoadOfflineEnricher(b.logger.WithContext(context.Background()), *offlineConfig, userRepo)
+		if err != nil {
+			return b.error(err)
+		}
+		if offlineConfig.Mode == enricher.OfflinePrimary {
+			stages = append([][]enricher.Enricher{{offline}}, stages...)
+		} else {
+			stages = append(stages, []enricher.Enricher{offline})
+		}
+		b.logger.Info().Str("mode", offlineConfig.Mode).Int("names", offline.Len()).Msg("offline enricher enabled")
+
+		statsConfig, err := configs.GetOfflineStatsWorkerConfig()
+		if err != nil {
+			return b.error(err)
+		}
+		statsWorker, err := worker.NewOfflineStatsWorker(*statsConfig, offline, b.logger)
+		if err != nil {
+			return b.error(err)
+		}
+		b.workers = append(b.workers, statsWorker)
+	}
+
+	enrichmentConfig, err := configs.GetEnrichmentConfig()
+	if err != nil {
+		return b.error(err)
+	}
+	enrichmentService, err := service.NewEnrichmentService(userRepo, jobRepo, stages, *enrichmentConfig)
+	if err != nil {
+		return b.error(err)
+	}
+
+	workerConfig, err := configs.GetEnrichmentWorkerConfig()
+	if err != nil {
+		return b.error(err)
+	}
+	enrichmentWorker, err := worker.NewEnrichmentWorker(*workerConfig, jobRepo, enrichmentService, b.logger)
+	if err != nil {
+		return b.error(err)
+	}
+	b.workers = append(b.workers, enrichmentWorker)
+
+	adminHandler, err := handler.NewAdminHandler(enrichmentService, quotas...)
+	if err != nil {
+		return b.error(err)
+	}
+
+	b.router.Mount("/admin", adminHandler.Routes())
+	return b
+}
+
+func (b *AppBuilder) WithHealthRouter() *AppBuilder {
+	if b.err != nil {
+		return b
+	}
+	healthHandler, err := handler.NewHealthHandler(b.db, b.predictors...)
+	if err != nil {
+		return b.error(err)
+	}
+
+	b.router.Get("/health", healthHandler.Health)
 	return b
 }
 
@@ -168,6 +315,12 @@ func (b *AppBuilder) Run() {
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, os.Interrupt)
 
+	workersCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+	for _, w := range b.workers {
+		w.Start(workersCtx)
+	}
+
 	go func() {
 		b.logger.Info().Msg("server running on " + b.server.Addr)
 		if err := b.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
@@ -185,6 +338,10 @@ func (b *AppBuilder) Run() {
 		b.logger.Error().Err(err).Msg("server shutdown failed")
 		return
 	}
+	stopWorkers()
+	for _, w := range b.workers {
+		w.Wait()
+	}
 	if err := b.db.Close(); err != nil {
 		b.logger.Error().Err(err).Msg("db connection close failed")
 		return
@@ -0,0 +1,59 @@
+package app
+
+import (
+	"effective-mobile-test-task/internal/cache"
+	"effective-mobile-test-task/internal/configs"
+	"effective-mobile-test-task/internal/enricher"
+	"effective-mobile-test-task/internal/handler"
+	"effective-mobile-test-task/internal/httpclient"
+	"effective-mobile-test-task/internal/repository"
+	"errors"
+
+	"github.com/rs/zerolog"
+)
+
+type (
+	// predictorAPI клиент API предсказаний, состояние которого отдают health и admin
+	predictorAPI interface {
+		handler.PredictorStatus
+		handler.QuotaReporter
+	}
+	// predictorAPIs подключенные API предсказаний и их источники обогащения.
+	// При optional=true API без ключа пропускается вместо ошибки
+	predictorAPIs struct {
+		cacheConfig cache.PredictorCacheConfig
+		cacheRepo   repository.PredictorCacheRepo
+		optional    bool
+		logger      zerolog.Logger
+		clients     []predictorAPI
+		enrichers   []enricher.Enricher
+	}
+)
+
+// addPredictorAPI создает клиент API, кэш его ответов и источник обогащения поверх кэша
+func addPredictorAPI[T httpclient.PredictorResponse](
+	apis *predictorAPIs,
+	getConfig func() (*httpclient.PredictorClientConfig, error),
+	newEnricher func(httpclient.Predictor[T], httpclient.ConfidenceThreshold) *enricher.PredictorEnricher[T]) error {
+	cfg, err := getConfig()
+	if apis.optional && errors.Is(err, configs.ErrNoAPIKey) {
+		apis.logger.Warn().Err(err).Msg("predictor API disabled, users are enriched by offline enricher")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	client, err := httpclient.NewPredictorClient[T](*cfg, apis.logger)
+	if err != nil {
+		return err
+	}
+	cached, err := cache.NewCachedPredictor[T](cfg.Name, apis.cacheConfig, client, apis.cacheRepo)
+	if err != nil {
+		return err
+	}
+
+	apis.clients = append(apis.clients, client)
+	apis.enrichers = append(apis.enrichers, newEnricher(cached, cfg.Threshold))
+	return nil
+}
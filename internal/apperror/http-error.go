@@ -2,32 +2,99 @@ package apperror
 
 import (
 	"fmt"
+	"net/http"
+	"strings"
 )
 
-type HttpError struct {
-	Code    int
-	Message string
-}
+// Машиночитаемые коды ошибок API
+const (
+	CodeBadRequest         = "bad_request"
+	CodeValidationFailed   = "validation_failed"
+	CodeNotFound           = "not_found"
+	CodeVersionMismatch    = "version_mismatch"
+	CodePreconditionFailed = "precondition_failed"
+	CodeDuplicate          = "duplicate"
+	CodeConflict           = "conflict"
+
+	CodeIdempotencyKeyReused     = "idempotency_key_reused"
+	CodeIdempotencyKeyInProgress = "idempotency_key_in_progress"
+	CodeInternal                 = "internal_error"
+)
 
+type (
+	HttpError struct {
+		Code      int
+		Message   string
+		ErrorCode string
+		Details   []ErrorDetail
+		// Meta дополнительные машиночитаемые сведения об ошибке
+		Meta map[string]interface{}
+	}
+	// ErrorDetail ошибка отдельного поля запроса
+	ErrorDetail struct {
+		Field   string
+		Code    string
+		Message string
+	}
+)
+
+// NewHttpError ошибка с кодом, соответствующим HTTP-статусу
 func NewHttpError(code int, message string) *HttpError {
 	return &HttpError{
-		Code:    code,
-		Message: message,
+		Code:      code,
+		Message:   message,
+		ErrorCode: defaultErrorCode(code),
+	}
+}
+
+// NewHttpErrorWithCode ошибка с явно заданным машиночитаемым кодом
+func NewHttpErrorWithCode(code int, errorCode string, message string) *HttpError {
+	return &HttpError{
+		Code:      code,
+		Message:   message,
+		ErrorCode: errorCode,
 	}
 }
 
+// NewValidationError ошибка 400 со списком ошибок по полям
+func NewValidationError(details []ErrorDetail) *HttpError {
+	return &HttpError{
+		Code:      http.StatusBadRequest,
+		Message:   "request validation failed",
+		ErrorCode: CodeValidationFailed,
+		Details:   details,
+	}
+}
+
+// WithMeta добавляет к ошибке дополнительное значение
+func (e *HttpError) WithMeta(key string, value interface{}) *HttpError {
+	if e.Meta == nil {
+		e.Meta = map[string]interface{}{}
+	}
+	e.Meta[key] = value
+	return e
+}
+
 func NewBadRequest(msg string, err error) *HttpError {
-	return &HttpError{Code: 400, Message: msg}
+	return NewHttpError(400, msg)
 }
 
 func NewNotFound(msg string, err error) *HttpError {
-	return &HttpError{Code: 404, Message: msg}
+	return NewHttpError(404, msg)
 }
 
 func NewInternal(msg string, err error) *HttpError {
-	return &HttpError{Code: 500, Message: msg}
+	return NewHttpError(500, msg)
 }
 
 func (e *HttpError) Error() string {
-	return fmt.Sprintf("status=%d message=%s", e.Code, e.Message)
+	return fmt.Sprintf("status=%d code=%s message=%s", e.Code, e.ErrorCode, e.Message)
+}
+
+// defaultErrorCode код по HTTP-статусу в snake_case, например precondition_failed
+func defaultErrorCode(status int) string {
+	if status == http.StatusInternalServerError {
+		return CodeInternal
+	}
+	return strings.ToLower(strings.ReplaceAll(http.StatusText(status), " ", "_"))
 }
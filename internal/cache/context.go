@@ -0,0 +1,16 @@
+package cache
+
+import "context"
+
+type bypassKey struct{}
+
+// WithBypass помечает запрос, для которого кэш предсказаний не читается:
+// ответ запрашивается у API заново и перезаписывает сохраненное значение
+func WithBypass(ctx context.Context) context.Context {
+	return context.WithValue(ctx, bypassKey{}, true)
+}
+
+func IsBypassed(ctx context.Context) bool {
+	bypass, _ := ctx.Value(bypassKey{}).(bool)
+	return bypass
+}
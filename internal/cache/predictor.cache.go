@@ -0,0 +1,188 @@
+package cache
+
+import (
+	"context"
+	"effective-mobile-test-task/internal/apperror"
+	"effective-mobile-test-task/internal/httpclient"
+	"effective-mobile-test-task/internal/model"
+	"effective-mobile-test-task/internal/repository"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+type PredictorCacheConfig struct {
+	TTL         time.Duration
+	NegativeTTL time.Duration
+	Size        int
+}
+
+func (c *PredictorCacheConfig) Validate() error {
+	if c.TTL < 0 || c.NegativeTTL < 0 {
+		return fmt.Errorf("cache TTL can't be negative")
+	}
+	if c.TTL == 0 {
+		c.TTL = 30 * 24 * time.Hour
+	}
+	if c.NegativeTTL == 0 {
+		c.NegativeTTL = 24 * time.Hour
+	}
+	if c.Size < 0 {
+		return fmt.Errorf("cache size can't be negative")
+	}
+	return nil
+}
+
+// CachedPredictor кэширует ответы API в памяти процесса (LRU) и в PostgreSQL.
+// Имена, которые API не знает, тоже кэшируются, но на NegativeTTL
+type CachedPredictor[T httpclient.PredictorResponse] struct {
+	api   httpclient.APIType
+	cfg   PredictorCacheConfig
+	next  httpclient.Predictor[T]
+	store repository.PredictorCacheRepo
+	lru   *LRU[string, T]
+}
+
+func NewCachedPredictor[T httpclient.PredictorResponse](
+	api httpclient.APIType,
+	cfg PredictorCacheConfig,
+	next httpclient.Predictor[T],
+	store repository.PredictorCacheRepo) (*CachedPredictor[T], error) {
+	methodName := "NewCachedPredictor"
+
+	if err := cfg.Validate(); err != nil {
+		return nil, apperror.NewAppError(methodName, "invalid cache config", err)
+	}
+	if next == nil {
+		return nil, apperror.NewAppError(methodName, "next predictor is required", nil)
+	}
+	if store == nil {
+		return nil, apperror.NewAppError(methodName, "store is required", nil)
+	}
+
+	return &CachedPredictor[T]{
+		api:   api,
+		cfg:   cfg,
+		next:  next,
+		store: store,
+		lru:   NewLRU[string, T](cfg.Size),
+	}, nil
+}
+
+func (cp *CachedPredictor[T]) Predict(ctx context.Context, name string) (*T, error) {
+	results, err := cp.PredictBatch(ctx, []string{name})
+	if err != nil {
+		return nil, err
+	}
+	return &results[0], nil
+}
+
+func (cp *CachedPredictor[T]) PredictBatch(ctx context.Context, names []string) ([]T, error) {
+	methodName := fmt.Sprintf("%s.CachedPredictor.PredictBatch", cp.api)
+	log := zerolog.Ctx(ctx).With().Str("method", methodName).Logger()
+
+	found := make(map[string]T, len(names))
+	misses := make([]string, 0)
+	seen := make(map[string]struct{}, len(names))
+
+	bypass := IsBypassed(ctx)
+	for _, name := range names {
+		key := cacheKey(name)
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+
+		if !bypass {
+			if res, ok := cp.lru.Get(key); ok {
+				log.Debug().Str("name", key).Str("source", "memory").Msg("prediction cache hit")
+				found[key] = res
+				continue
+			}
+		}
+		misses = append(misses, key)
+	}
+
+	if !bypass && len(misses) > 0 {
+		entries, err := cp.store.Get(ctx, string(cp.api), misses)
+		if err != nil {
+			log.Warn().Err(err).Msg("failed to read prediction cache, falling back to API")
+			entries = nil
+		}
+
+		stillMissing := misses[:0]
+		for _, key := range misses {
+			entry, ok := entries[key]
+			if !ok {
+				stillMissing = append(stillMissing, key)
+				continue
+			}
+
+			var res T
+			if err := json.Unmarshal(entry.Response, &res); err != nil {
+				log.Warn().Str("name", key).Err(err).Msg("broken prediction cache entry")
+				stillMissing = append(stillMissing, key)
+				continue
+			}
+			log.Debug().Str("name", key).Str("source", "postgres").Bool("known", entry.Known).Msg("prediction cache hit")
+			cp.lru.Set(key, res, time.Now().Add(entry.TTL))
+			found[key] = res
+		}
+		misses = stillMissing
+	}
+
+	if bypass {
+		log.Debug().Int("names", len(misses)).Msg("prediction cache bypassed")
+	} else {
+		log.Debug().Int("hits", len(found)).Int("misses", len(misses)).Msg("prediction cache lookup finished")
+	}
+
+	if len(misses) > 0 {
+		fetched, err := cp.next.PredictBatch(ctx, misses)
+		if err != nil {
+			return nil, err
+		}
+
+		now := time.Now()
+		entries := make([]model.PredictionCacheEntry, 0, len(fetched))
+		for i, res := range fetched {
+			key := misses[i]
+			found[key] = res
+
+			raw, err := json.Marshal(res)
+			if err != nil {
+				return nil, apperror.NewAppError(methodName, "response marshalling error", err)
+			}
+			ttl := cp.cfg.TTL
+			if !res.Known() {
+				ttl = cp.cfg.NegativeTTL
+			}
+
+			cp.lru.Set(key, res, now.Add(ttl))
+			entries = append(entries, model.PredictionCacheEntry{
+				API:      string(cp.api),
+				Name:     key,
+				Response: raw,
+				Known:    res.Known(),
+				TTL:      ttl,
+			})
+		}
+
+		if err := cp.store.Set(ctx, entries); err != nil {
+			log.Warn().Err(err).Msg("failed to save predictions into cache")
+		}
+	}
+
+	results := make([]T, len(names))
+	for i, name := range names {
+		results[i] = found[cacheKey(name)]
+	}
+	return results, nil
+}
+
+func cacheKey(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
@@ -8,19 +8,24 @@ import (
 )
 
 func GetAgifyConfig() (*httpclient.PredictorClientConfig, error) {
-	token := os.Getenv("API_TOKEN")
-	if token == "" {
-		return nil, fmt.Errorf("API_TOKEN is required")
-	}
-
 	baseURL := os.Getenv("AGIFY_BASE_URL")
 	if baseURL == "" {
 		return nil, fmt.Errorf("AGIFY_BASE_URL is required")
 	}
 
-	return &httpclient.PredictorClientConfig{
+	cfg := &httpclient.PredictorClientConfig{
 		Name:    httpclient.Agify,
-		Token:   token,
 		BaseURL: strings.TrimSuffix(baseURL, "/"),
-	}, nil
+	}
+	if err := applyAuthConfig("AGIFY", cfg); err != nil {
+		return nil, err
+	}
+	if err := applyResilienceConfig("AGIFY", cfg); err != nil {
+		return nil, err
+	}
+	if err := applyThresholdConfig("AGIFY", cfg); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
 }
@@ -0,0 +1,40 @@
+package configs
+
+import (
+	"effective-mobile-test-task/internal/service"
+	"effective-mobile-test-task/internal/worker"
+)
+
+func GetEnrichmentConfig() (*service.EnrichmentConfig, error) {
+	var err error
+	cfg := &service.EnrichmentConfig{}
+
+	if cfg.MaxAttempts, err = getIntEnv("ENRICHMENT_MAX_ATTEMPTS"); err != nil {
+		return nil, err
+	}
+	if cfg.RetryDelay, err = getDurationEnv("ENRICHMENT_RETRY_DELAY"); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+func GetEnrichmentWorkerConfig() (*worker.EnrichmentWorkerConfig, error) {
+	var err error
+	cfg := &worker.EnrichmentWorkerConfig{}
+
+	if cfg.Workers, err = getIntEnv("ENRICHMENT_WORKERS"); err != nil {
+		return nil, err
+	}
+	if cfg.BatchSize, err = getIntEnv("ENRICHMENT_BATCH_SIZE"); err != nil {
+		return nil, err
+	}
+	if cfg.PollInterval, err = getDurationEnv("ENRICHMENT_POLL_INTERVAL"); err != nil {
+		return nil, err
+	}
+	if cfg.Lease, err = getDurationEnv("ENRICHMENT_LEASE"); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
@@ -8,19 +8,24 @@ import (
 )
 
 func GetGenderizeConfig() (*httpclient.PredictorClientConfig, error) {
-	token := os.Getenv("API_TOKEN")
-	if token == "" {
-		return nil, fmt.Errorf("API_TOKEN is required")
-	}
-
 	baseURL := os.Getenv("GENDERIZE_BASE_URL")
 	if baseURL == "" {
 		return nil, fmt.Errorf("GENDERIZE_BASE_URL is required")
 	}
 
-	return &httpclient.PredictorClientConfig{
+	cfg := &httpclient.PredictorClientConfig{
 		Name:    httpclient.Genderize,
-		Token:   token,
 		BaseURL: strings.TrimSuffix(baseURL, "/"),
-	}, nil
+	}
+	if err := applyAuthConfig("GENDERIZE", cfg); err != nil {
+		return nil, err
+	}
+	if err := applyResilienceConfig("GENDERIZE", cfg); err != nil {
+		return nil, err
+	}
+	if err := applyThresholdConfig("GENDERIZE", cfg); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
 }
@@ -0,0 +1,17 @@
+package configs
+
+import "effective-mobile-test-task/internal/service"
+
+func GetIdempotencyConfig() (*service.IdempotencyConfig, error) {
+	var err error
+	cfg := &service.IdempotencyConfig{}
+
+	if cfg.TTL, err = getDurationEnv("IDEMPOTENCY_KEY_TTL"); err != nil {
+		return nil, err
+	}
+	if cfg.LockTimeout, err = getDurationEnv("IDEMPOTENCY_LOCK_TIMEOUT"); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
@@ -8,19 +8,24 @@ import (
 )
 
 func GetNationalizeConfig() (*httpclient.PredictorClientConfig, error) {
-	token := os.Getenv("API_TOKEN")
-	if token == "" {
-		return nil, fmt.Errorf("API_TOKEN is required")
-	}
-
 	baseURL := os.Getenv("NATIONALIZE_BASE_URL")
 	if baseURL == "" {
 		return nil, fmt.Errorf("NATIONALIZE_BASE_URL is required")
 	}
 
-	return &httpclient.PredictorClientConfig{
+	cfg := &httpclient.PredictorClientConfig{
 		Name:    httpclient.Nationalize,
-		Token:   token,
 		BaseURL: strings.TrimSuffix(baseURL, "/"),
-	}, nil
+	}
+	if err := applyAuthConfig("NATIONALIZE", cfg); err != nil {
+		return nil, err
+	}
+	if err := applyResilienceConfig("NATIONALIZE", cfg); err != nil {
+		return nil, err
+	}
+	if err := applyThresholdConfig("NATIONALIZE", cfg); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
 }
@@ -0,0 +1,46 @@
+package configs
+
+import (
+	"effective-mobile-test-task/internal/enricher"
+	"effective-mobile-test-task/internal/worker"
+	"fmt"
+	"os"
+)
+
+// GetOfflineEnricherConfig читает настройки офлайн-источника обогащения.
+// OFFLINE_ENRICHER_MODE: disabled (по умолчанию), fallback или primary
+func GetOfflineEnricherConfig() (*enricher.OfflineConfig, error) {
+	var err error
+	cfg := &enricher.OfflineConfig{
+		Mode:        os.Getenv("OFFLINE_ENRICHER_MODE"),
+		DatasetPath: os.Getenv("OFFLINE_DATASET_PATH"),
+	}
+
+	if cfg.FromUsers, err = getBoolEnv("OFFLINE_FROM_USERS"); err != nil {
+		return nil, err
+	}
+	if cfg.Threshold.MinProbability, err = getFloatEnv("OFFLINE_MIN_PROBABILITY"); err != nil {
+		return nil, err
+	}
+	minCount, err := getIntEnv("OFFLINE_MIN_COUNT")
+	if err != nil {
+		return nil, err
+	}
+	if minCount < 0 {
+		return nil, fmt.Errorf("OFFLINE_MIN_COUNT must not be negative")
+	}
+	cfg.Threshold.MinCount = uint(minCount)
+
+	return cfg, nil
+}
+
+func GetOfflineStatsWorkerConfig() (*worker.OfflineStatsWorkerConfig, error) {
+	var err error
+	cfg := &worker.OfflineStatsWorkerConfig{}
+
+	if cfg.Interval, err = getDurationEnv("OFFLINE_RELOAD_INTERVAL"); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
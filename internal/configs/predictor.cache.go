@@ -0,0 +1,40 @@
+package configs
+
+import (
+	"effective-mobile-test-task/internal/cache"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+func GetPredictorCacheConfig() (*cache.PredictorCacheConfig, error) {
+	cfg := &cache.PredictorCacheConfig{}
+
+	if ttl := os.Getenv("PREDICTOR_CACHE_TTL"); ttl != "" {
+		d, err := time.ParseDuration(ttl)
+		if err != nil {
+			return nil, fmt.Errorf("PREDICTOR_CACHE_TTL must be a duration: %w", err)
+		}
+		cfg.TTL = d
+	}
+
+	if negativeTTL := os.Getenv("PREDICTOR_CACHE_NEGATIVE_TTL"); negativeTTL != "" {
+		d, err := time.ParseDuration(negativeTTL)
+		if err != nil {
+			return nil, fmt.Errorf("PREDICTOR_CACHE_NEGATIVE_TTL must be a duration: %w", err)
+		}
+		cfg.NegativeTTL = d
+	}
+
+	cfg.Size = 10000
+	if size := os.Getenv("PREDICTOR_CACHE_SIZE"); size != "" {
+		n, err := strconv.Atoi(size)
+		if err != nil {
+			return nil, fmt.Errorf("PREDICTOR_CACHE_SIZE must be a number: %w", err)
+		}
+		cfg.Size = n
+	}
+
+	return cfg, nil
+}
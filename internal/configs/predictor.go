@@ -0,0 +1,132 @@
+package configs
+
+import (
+	"effective-mobile-test-task/internal/httpclient"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// ErrNoAPIKey не задан ни ключ API, ни общий API_TOKEN
+var ErrNoAPIKey = errors.New("API key is not set")
+
+// applyAuthConfig читает ключ API и способ его передачи, например AGIFY_API_KEY,
+// AGIFY_AUTH_PLACEMENT (query, bearer, header) и AGIFY_AUTH_NAME. Если ключ API не задан,
+// используется общий API_TOKEN
+func applyAuthConfig(prefix string, cfg *httpclient.PredictorClientConfig) error {
+	cfg.Token = os.Getenv(prefix + "_API_KEY")
+	if cfg.Token == "" {
+		cfg.Token = os.Getenv("API_TOKEN")
+	}
+	if cfg.Token == "" {
+		return fmt.Errorf("%w: %s_API_KEY or API_TOKEN is required", ErrNoAPIKey, prefix)
+	}
+	cfg.Auth.Placement = httpclient.AuthPlacement(os.Getenv(prefix + "_AUTH_PLACEMENT"))
+	cfg.Auth.Name = os.Getenv(prefix + "_AUTH_NAME")
+
+	return nil
+}
+
+// applyResilienceConfig читает настройки повторов, circuit breaker, резерва квоты и объединения
+// запросов для API, например AGIFY_RETRY_MAX_ATTEMPTS, AGIFY_QUOTA_RESERVE или AGIFY_BATCH_WINDOW.
+// Незаданные значения остаются нулевыми и заполняются в PredictorClientConfig.Validate
+func applyResilienceConfig(prefix string, cfg *httpclient.PredictorClientConfig) error {
+	var err error
+
+	if cfg.Retry.MaxAttempts, err = getIntEnv(prefix + "_RETRY_MAX_ATTEMPTS"); err != nil {
+		return err
+	}
+	if cfg.Retry.BaseDelay, err = getDurationEnv(prefix + "_RETRY_BASE_DELAY"); err != nil {
+		return err
+	}
+	if cfg.Retry.MaxDelay, err = getDurationEnv(prefix + "_RETRY_MAX_DELAY"); err != nil {
+		return err
+	}
+	if cfg.Breaker.FailureThreshold, err = getIntEnv(prefix + "_BREAKER_FAILURE_THRESHOLD"); err != nil {
+		return err
+	}
+	if cfg.Breaker.OpenTimeout, err = getDurationEnv(prefix + "_BREAKER_OPEN_TIMEOUT"); err != nil {
+		return err
+	}
+	if cfg.QuotaReserve, err = getIntEnv(prefix + "_QUOTA_RESERVE"); err != nil {
+		return err
+	}
+	if cfg.BatchSize, err = getIntEnv(prefix + "_BATCH_SIZE"); err != nil {
+		return err
+	}
+	if cfg.BatchWindow, err = getDurationEnv(prefix + "_BATCH_WINDOW"); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// applyThresholdConfig читает пороги достоверности предсказаний API,
+// например GENDERIZE_MIN_PROBABILITY или NATIONALIZE_MIN_COUNT
+func applyThresholdConfig(prefix string, cfg *httpclient.PredictorClientConfig) error {
+	var err error
+
+	if cfg.Threshold.MinProbability, err = getFloatEnv(prefix + "_MIN_PROBABILITY"); err != nil {
+		return err
+	}
+	minCount, err := getIntEnv(prefix + "_MIN_COUNT")
+	if err != nil {
+		return err
+	}
+	if minCount < 0 {
+		return fmt.Errorf("%s_MIN_COUNT must not be negative", prefix)
+	}
+	cfg.Threshold.MinCount = uint(minCount)
+
+	return nil
+}
+
+func getIntEnv(key string) (int, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be a number: %w", key, err)
+	}
+	return n, nil
+}
+
+func getFloatEnv(key string) (float64, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return 0, nil
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be a number: %w", key, err)
+	}
+	return f, nil
+}
+
+func getBoolEnv(key string) (bool, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("%s must be a boolean: %w", key, err)
+	}
+	return b, nil
+}
+
+func getDurationEnv(key string) (time.Duration, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be a duration: %w", key, err)
+	}
+	return d, nil
+}
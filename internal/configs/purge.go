@@ -0,0 +1,20 @@
+package configs
+
+import "effective-mobile-test-task/internal/worker"
+
+func GetPurgeWorkerConfig() (*worker.PurgeWorkerConfig, error) {
+	var err error
+	cfg := &worker.PurgeWorkerConfig{}
+
+	if cfg.Retention, err = getDurationEnv("USERS_PURGE_RETENTION"); err != nil {
+		return nil, err
+	}
+	if cfg.Interval, err = getDurationEnv("USERS_PURGE_INTERVAL"); err != nil {
+		return nil, err
+	}
+	if cfg.BatchSize, err = getIntEnv("USERS_PURGE_BATCH_SIZE"); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
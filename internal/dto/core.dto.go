@@ -10,9 +10,18 @@ type (
 	EmptyResponseDTO struct {
 		Success bool `json:"success" default:"true"` // Статус операции
 	}
-	// ErrorPayload полезная нагрузка с текстом ошибки
+	// ErrorPayload полезная нагрузка с описанием ошибки
 	ErrorPayload struct {
-		Message string `json:"message"` // Текст ошибки
+		Code    string                 `json:"code" example:"validation_failed"`            // Машиночитаемый код ошибки
+		Message string                 `json:"message" example:"request validation failed"` // Текст ошибки
+		Details []ErrorDetailPayload   `json:"details,omitempty"`                           // Ошибки отдельных полей запроса
+		Meta    map[string]interface{} `json:"meta,omitempty"`                              // Дополнительные сведения, например existing_uuid для code=duplicate
+	}
+	// ErrorDetailPayload ошибка отдельного поля запроса
+	ErrorDetailPayload struct {
+		Field   string `json:"field" example:"gender"`                         // Название поля
+		Code    string `json:"code" example:"invalid_value"`                   // Машиночитаемый код ошибки поля
+		Message string `json:"message" example:"must be one of: male, female"` // Текст ошибки поля
 	}
 	// ErrorResponseDTO ответ при ошибке
 	ErrorResponseDTO struct {
@@ -0,0 +1,20 @@
+package dto
+
+import "time"
+
+type (
+	// EnrichmentRequeuePayload результат повторной постановки пользователей в очередь обогащения
+	EnrichmentRequeuePayload struct {
+		Queued int64 `json:"queued" example:"42"` // Количество пользователей, поставленных в очередь
+	}
+	// QuotaPayload состояние квоты публичного API
+	QuotaPayload struct {
+		Provider  string     `json:"provider" example:"agify"`                            // Название API
+		Limit     *int       `json:"limit,omitempty" example:"1000"`                      // Размер квоты на окно
+		Remaining *int       `json:"remaining,omitempty" example:"120"`                   // Остаток квоты, не передается, пока API не сообщил квоту
+		Reserve   int        `json:"reserve" example:"100"`                               // Резерв, который не расходуется клиентом
+		ResetAt   *time.Time `json:"reset_at,omitempty" example:"2025-01-02T00:00:00Z"`   // Время восстановления квоты
+		UpdatedAt *time.Time `json:"updated_at,omitempty" example:"2025-01-01T12:00:00Z"` // Время последнего ответа с квотой
+		Throttled bool       `json:"throttled" example:"false"`                           // Запросы к API приостановлены до восстановления квоты
+	}
+)
@@ -0,0 +1,10 @@
+package dto
+
+type (
+	// HealthPayload состояние сервиса и его зависимостей
+	HealthPayload struct {
+		Status     string            `json:"status" example:"ok"`                    // ok, degraded (недоступен один из API) или down (недоступна БД)
+		Database   string            `json:"database" example:"ok"`                  // Состояние подключения к БД
+		Predictors map[string]string `json:"predictors" swaggertype:"object,string"` // Состояние circuit breaker каждого API: closed, open, half_open
+	}
+)
@@ -1,7 +1,12 @@
 package dto
 
 import (
+	"effective-mobile-test-task/internal/model"
+	"effective-mobile-test-task/internal/normalize"
 	"effective-mobile-test-task/internal/types"
+	"effective-mobile-test-task/internal/validation"
+	"slices"
+	"strings"
 )
 
 type (
@@ -10,34 +15,235 @@ type (
 		Name       types.Name        `json:"name" example:"Dmitriy"`                    // Имя пользователя
 		Surname    types.Surname     `json:"surname" example:"Ushakov"`                 // Фамилия пользователя
 		Patronymic *types.Patronymic `json:"patronymic,omitempty" example:"Vasilevich"` // Отчество пользователя (необязательное поле)
+		Age        *types.Age        `json:"age,omitempty" example:"22"`                // Известный возраст пользователя, не перезаписывается обогащением
+		Gender     *types.Gender     `json:"gender,omitempty" example:"male"`           // Известный пол пользователя, не перезаписывается обогащением
+		CountryID  *types.CountryID  `json:"country_id,omitempty" example:"RU"`         // Известная страна пользователя, не перезаписывается обогащением
 	}
-	// UserUpdateDTO поля для обнолвения данных пользователя
+	// UserUpdateDTO поля для обнолвения данных пользователя в формате JSON Merge Patch:
+	// отсутствующее поле не меняется, null очищает значение
 	UserUpdateDTO struct {
-		Name       *types.Name       `json:"name,omitempty" example:"Dmitriy"`                         // Имя пользователя
-		Surname    *types.Surname    `json:"surname,omitempty" example:"Ushakov"`                      // Фамилия пользователя
-		Patronymic *types.Patronymic `json:"patronymic,omitempty" example:"Vasilevich"`                // Отчество пользователя
-		Age        *types.Age        `json:"age,omitempty" example:"22"`                               // Возврат пользователя
-		Gender     *types.Gender     `json:"gender,omitempty" example:"male"`                          // Пол пользователя
-		CountryID  *types.CountryID  `json:"country_id,omitempty" example:"2006-01-02T15:04:05Z07:00"` // Строковый ID страны пользователя
+		Name       types.Nullable[types.Name]       `json:"name" swaggertype:"string" example:"Dmitriy"`          // Имя пользователя (null недопустим)
+		Surname    types.Nullable[types.Surname]    `json:"surname" swaggertype:"string" example:"Ushakov"`       // Фамилия пользователя (null недопустим)
+		Patronymic types.Nullable[types.Patronymic] `json:"patronymic" swaggertype:"string" example:"Vasilevich"` // Отчество пользователя
+		Age        types.Nullable[types.Age]        `json:"age" swaggertype:"integer" example:"22"`               // Возврат пользователя
+		Gender     types.Nullable[types.Gender]     `json:"gender" swaggertype:"string" example:"male"`           // Пол пользователя
+		CountryID  types.Nullable[types.CountryID]  `json:"country_id" swaggertype:"string" example:"RU"`         // Строковый ID страны пользователя
+	}
+	// UserReplaceDTO данные пользователя для полной замены: отсутствующие необязательные поля очищаются
+	UserReplaceDTO struct {
+		Name       types.Name        `json:"name" example:"Dmitriy"`                    // Имя пользователя
+		Surname    types.Surname     `json:"surname" example:"Ushakov"`                 // Фамилия пользователя
+		Patronymic *types.Patronymic `json:"patronymic,omitempty" example:"Vasilevich"` // Отчество пользователя
+		Age        *types.Age        `json:"age,omitempty" example:"22"`                // Возврат пользователя
+		Gender     *types.Gender     `json:"gender,omitempty" example:"male"`           // Пол пользователя
+		CountryID  *types.CountryID  `json:"country_id,omitempty" example:"RU"`         // Строковый ID страны пользователя
+	}
+	// UserMergeDTO параметры слияния пользователя-дубликата с пользователем из пути запроса
+	UserMergeDTO struct {
+		SourceUUID types.UUID        `json:"source_uuid" example:"8d571787-9981-4add-a713-2fde6236e84b"` // ID пользователя-дубликата, который удаляется после слияния
+		Prefer     map[string]string `json:"prefer,omitempty"`                                           // Откуда взять поле (patronymic, age, gender, country_id): target или source. По умолчанию из source берутся только поля, не заполненные у target
 	}
 	// UserPayload поля для обнолвения данных пользователя
 	UserPayload struct {
-		UUID       types.UUID        `json:"uuid" example:"8d571787-9981-4add-a713-2fde6236e84b"` // ID пользователя
-		Name       types.Name        `json:"name" example:"Dmitriy"`                              // Имя пользователя
-		Surname    types.Surname     `json:"surname" example:"Ushakov"`                           // Фамилия пользователя
-		Patronymic *types.Patronymic `json:"patronymic,omitempty" example:"Vasilevich"`           // Отчество пользователя
-		Age        *types.Age        `json:"age,omitempty" example:"22"`                          // Возврат пользователя
-		Gender     *types.Gender     `json:"gender,omitempty" example:"male"`                     // Пол пользователя
-		CountryID  *types.CountryID  `json:"country_id,omitempty" example:"RU"`                   // Строковый ID страны пользователя
-		CreatedAt  string            `json:"created_at" example:"2006-01-02T15:04:05Z07:00"`      // Строковое представление даты создания пользователя
+		UUID               types.UUID                        `json:"uuid" example:"8d571787-9981-4add-a713-2fde6236e84b"`                   // ID пользователя
+		Name               types.Name                        `json:"name" example:"Dmitriy"`                                                // Имя пользователя
+		Surname            types.Surname                     `json:"surname" example:"Ushakov"`                                             // Фамилия пользователя
+		Patronymic         *types.Patronymic                 `json:"patronymic,omitempty" example:"Vasilevich"`                             // Отчество пользователя
+		NameLatin          types.Name                        `json:"name_latin" example:"Dmitrii"`                                          // Имя пользователя в латинской транслитерации (ICAO)
+		SurnameLatin       types.Surname                     `json:"surname_latin" example:"Ushakov"`                                       // Фамилия пользователя в латинской транслитерации (ICAO)
+		PatronymicLatin    *types.Patronymic                 `json:"patronymic_latin,omitempty" example:"Vasilevich"`                       // Отчество пользователя в латинской транслитерации (ICAO)
+		Age                *types.Age                        `json:"age,omitempty" example:"22"`                                            // Возврат пользователя
+		Gender             *types.Gender                     `json:"gender,omitempty" example:"male"`                                       // Пол пользователя
+		CountryID          *types.CountryID                  `json:"country_id,omitempty" example:"RU"`                                     // Строковый ID страны пользователя
+		DuplicateOf        *types.UUID                       `json:"duplicate_of,omitempty" example:"8d571787-9981-4add-a713-2fde6236e84b"` // ID пользователя, дубликатом которого является этот (в том числе после слияния)
+		Version            types.Version                     `json:"version" example:"3"`                                                   // Версия пользователя, совпадает со значением ETag
+		EnrichmentStatus   types.EnrichmentStatus            `json:"enrichment_status" example:"done"`                                      // Статус обогащения: pending, done, incomplete, needs_review, failed
+		AgeCount           *types.SampleCount                `json:"age_count,omitempty" example:"1520"`                                    // Размер выборки, по которой предсказан возраст
+		GenderProbability  *types.Probability                `json:"gender_probability,omitempty" example:"0.99"`                           // Вероятность предсказанного пола
+		GenderCount        *types.SampleCount                `json:"gender_count,omitempty" example:"1520"`                                 // Размер выборки, по которой предсказан пол
+		CountryProbability *types.Probability                `json:"country_probability,omitempty" example:"0.87"`                          // Вероятность предсказанной страны
+		CountryCount       *types.SampleCount                `json:"country_count,omitempty" example:"1520"`                                // Размер выборки, по которой предсказана страна
+		Countries          []CountryProbabilityPayload       `json:"countries,omitempty"`                                                   // Все предсказанные страны в порядке убывания вероятности
+		ReviewReasons      map[string]string                 `json:"review_reasons,omitempty"`                                              // Поля, предсказания для которых не прошли порог достоверности, и причины
+		Provenance         map[string]FieldProvenancePayload `json:"provenance,omitempty"`                                                  // Происхождение значений age, gender и country_id
+		DeletedAt          *string                           `json:"deleted_at,omitempty" example:"2006-01-02T15:04:05Z07:00"`              // Строковое представление даты удаления пользователя (только при include_deleted=true)
+		CreatedAt          string                            `json:"created_at" example:"2006-01-02T15:04:05Z07:00"`                        // Строковое представление даты создания пользователя
+		UpdatedAt          string                            `json:"updated_at" example:"2006-01-02T15:04:05Z07:00"`                        // Строковое представление даты последнего обновления пользователя
+	}
+	// CountryProbabilityPayload предсказанная страна и ее вероятность
+	CountryProbabilityPayload struct {
+		CountryID   types.CountryID   `json:"country_id" example:"RU"`    // Строковый ID страны
+		Probability types.Probability `json:"probability" example:"0.87"` // Вероятность от 0 до 1
+	}
+	// FieldProvenancePayload происхождение значения поля
+	FieldProvenancePayload struct {
+		Kind   string `json:"kind" example:"manual"`                      // predicted - предсказано API, manual - задано вручную, imported - передано при создании
+		Source string `json:"source" example:"api"`                       // Источник значения: название API для predicted, api для manual, import для imported
+		SetAt  string `json:"set_at" example:"2006-01-02T15:04:05Z07:00"` // Строковое представление даты установки значения
 	}
 	// ListOfUsersPayload полезная нагрузка со списком пользователей
 	ListOfUsersPayload struct {
-		Total int           `json:"total" example:"0"` // Общее количество записей с переданными фильтрами
-		Users []UserPayload `json:"users"`             // Список пользователей на указанной странице
+		Total      *int          `json:"total,omitempty" example:"0"`                              // Общее количество записей с переданными фильтрами (отсутствует при with_total=false)
+		NextCursor *types.Cursor `json:"next_cursor,omitempty" example:"eyJvIjoiY3JlYXRlZF9hdCJ9"` // Курсор следующей страницы (только в режиме курсорной пагинации, отсутствует на последней странице)
+		Users      []UserPayload `json:"users"`                                                    // Список пользователей на указанной странице
+	}
+	// UserBatchItemPayload результат создания одного пользователя из пакета
+	UserBatchItemPayload struct {
+		Index        int                  `json:"index" example:"0"`                                                      // Позиция пользователя в переданном массиве
+		UUID         *types.UUID          `json:"uuid,omitempty" example:"8d571787-9981-4add-a713-2fde6236e84b"`          // ID созданного пользователя
+		DuplicateOf  *types.UUID          `json:"duplicate_of,omitempty" example:"7c460676-8870-3bdc-b602-1edf5125d73a"`  // ID найденного дубликата, с которым связан пользователь (при on_duplicate=link)
+		ExistingUUID *types.UUID          `json:"existing_uuid,omitempty" example:"7c460676-8870-3bdc-b602-1edf5125d73a"` // ID существующего пользователя с тем же ФИО, из-за которого пользователь не был создан
+		Error        *string              `json:"error,omitempty" example:"surname: must not be empty"`                   // Причина, по которой пользователь не был создан
+		Details      []ErrorDetailPayload `json:"details,omitempty"`                                                      // Ошибки отдельных полей пользователя
+	}
+	// UserBatchCreatePayload полезная нагрузка с результатами пакетного создания пользователей
+	UserBatchCreatePayload struct {
+		Created int                    `json:"created" example:"1"` // Количество созданных пользователей
+		Failed  int                    `json:"failed" example:"0"`  // Количество пользователей, не прошедших валидацию или отклоненных как дубликаты
+		Results []UserBatchItemPayload `json:"results"`             // Результаты в порядке переданного массива
+	}
+	// UserChangePayload одно изменение пользователя
+	UserChangePayload struct {
+		ID        int64                  `json:"id" example:"1"`                                      // Порядковый номер изменения
+		Operation string                 `json:"operation" example:"UPDATE"`                          // Операция: INSERT, UPDATE, DELETE
+		Old       map[string]interface{} `json:"old,omitempty"`                                       // Значения до изменения (для UPDATE - только изменившиеся поля)
+		New       map[string]interface{} `json:"new,omitempty"`                                       // Значения после изменения (для UPDATE - только изменившиеся поля)
+		RequestID *string                `json:"request_id,omitempty" example:"cr3vq1hd0cvs73a0b6a0"` // ID запроса, в рамках которого произошло изменение (отсутствует для фонового обогащения)
+		ChangedAt string                 `json:"changed_at" example:"2006-01-02T15:04:05Z07:00"`      // Строковое представление даты изменения
+	}
+	// UserHistoryPayload полезная нагрузка с историей изменений пользователя
+	UserHistoryPayload struct {
+		Changes []UserChangePayload `json:"changes"` // Изменения в порядке применения
 	}
 	// UserCreatePayload полезная нагрузка, содержащая информацию о созданном ползователе
 	UserCreatePayload struct {
-		UUID types.UUID `json:"uuid" example:"8d571787-9981-4add-a713-2fde6236e84b"` // ID пользователя
+		UUID        types.UUID  `json:"uuid" example:"8d571787-9981-4add-a713-2fde6236e84b"`                   // ID пользователя
+		DuplicateOf *types.UUID `json:"duplicate_of,omitempty" example:"7c460676-8870-3bdc-b602-1edf5125d73a"` // ID найденного дубликата, с которым связан пользователь (при on_duplicate=link)
 	}
 )
+
+// Normalize приводит ФИО к единому виду, см. normalize.Name
+func (d *UserCreateDTO) Normalize() {
+	d.Name = types.Name(normalize.Name(string(d.Name)))
+	d.Surname = types.Surname(normalize.Name(string(d.Surname)))
+	if d.Patronymic != nil {
+		p := types.Patronymic(normalize.Name(string(*d.Patronymic)))
+		d.Patronymic = &p
+	}
+}
+
+// Validate проверяет все поля и возвращает validation.Errors со списком ошибок
+func (d *UserCreateDTO) Validate() error {
+	v := &validation.Validator{}
+	v.Name("name", string(d.Name))
+	v.Name("surname", string(d.Surname))
+	if d.Patronymic != nil {
+		v.Name("patronymic", string(*d.Patronymic))
+	}
+	if d.Age != nil {
+		v.Age("age", uint64(*d.Age))
+	}
+	if d.Gender != nil {
+		v.Gender("gender", string(*d.Gender))
+	}
+	if d.CountryID != nil {
+		v.CountryID("country_id", string(*d.CountryID))
+	}
+	return v.Err()
+}
+
+// HasUpdates сообщает, передано ли хотя бы одно поле
+func (d *UserUpdateDTO) HasUpdates() bool {
+	return d.Name.Set || d.Surname.Set || d.Patronymic.Set || d.Age.Set || d.Gender.Set || d.CountryID.Set
+}
+
+// Normalize приводит переданные ФИО к единому виду, см. normalize.Name
+func (d *UserUpdateDTO) Normalize() {
+	if d.Name.Value != nil {
+		n := types.Name(normalize.Name(string(*d.Name.Value)))
+		d.Name.Value = &n
+	}
+	if d.Surname.Value != nil {
+		s := types.Surname(normalize.Name(string(*d.Surname.Value)))
+		d.Surname.Value = &s
+	}
+	if d.Patronymic.Value != nil {
+		p := types.Patronymic(normalize.Name(string(*d.Patronymic.Value)))
+		d.Patronymic.Value = &p
+	}
+}
+
+// Validate проверяет переданные поля и возвращает validation.Errors со списком ошибок
+func (d *UserUpdateDTO) Validate() error {
+	v := &validation.Validator{}
+	if d.Name.IsNull() {
+		v.Add("name", validation.CodeNotNull, "must not be null")
+	} else if d.Name.Set {
+		v.Name("name", string(*d.Name.Value))
+	}
+	if d.Surname.IsNull() {
+		v.Add("surname", validation.CodeNotNull, "must not be null")
+	} else if d.Surname.Set {
+		v.Name("surname", string(*d.Surname.Value))
+	}
+	if d.Patronymic.Value != nil {
+		v.Name("patronymic", string(*d.Patronymic.Value))
+	}
+	if d.Age.Value != nil {
+		v.Age("age", uint64(*d.Age.Value))
+	}
+	if d.Gender.Value != nil {
+		v.Gender("gender", string(*d.Gender.Value))
+	}
+	if d.CountryID.Value != nil {
+		v.CountryID("country_id", string(*d.CountryID.Value))
+	}
+	return v.Err()
+}
+
+// Normalize приводит ФИО к единому виду, см. normalize.Name
+func (d *UserReplaceDTO) Normalize() {
+	d.Name = types.Name(normalize.Name(string(d.Name)))
+	d.Surname = types.Surname(normalize.Name(string(d.Surname)))
+	if d.Patronymic != nil {
+		p := types.Patronymic(normalize.Name(string(*d.Patronymic)))
+		d.Patronymic = &p
+	}
+}
+
+// Validate проверяет все поля и возвращает validation.Errors со списком ошибок
+func (d *UserReplaceDTO) Validate() error {
+	v := &validation.Validator{}
+	v.Name("name", string(d.Name))
+	v.Name("surname", string(d.Surname))
+	if d.Patronymic != nil {
+		v.Name("patronymic", string(*d.Patronymic))
+	}
+	if d.Age != nil {
+		v.Age("age", uint64(*d.Age))
+	}
+	if d.Gender != nil {
+		v.Gender("gender", string(*d.Gender))
+	}
+	if d.CountryID != nil {
+		v.CountryID("country_id", string(*d.CountryID))
+	}
+	return v.Err()
+}
+
+// Validate проверяет параметры слияния и возвращает validation.Errors со списком ошибок
+func (d *UserMergeDTO) Validate(target types.UUID) error {
+	v := &validation.Validator{}
+	if d.SourceUUID == "" {
+		v.Add("source_uuid", validation.CodeRequired, "must not be empty")
+	} else {
+		v.Check(d.SourceUUID != target, "source_uuid", validation.CodeInvalidValue, "must differ from the merged user")
+	}
+	for field, side := range d.Prefer {
+		v.Check(slices.Contains(model.MergeableFields, field), "prefer."+field, validation.CodeInvalidValue,
+			"field can't be merged, allowed: "+strings.Join(model.MergeableFields, ", "))
+		v.Check(side == model.MergeTarget || side == model.MergeSource, "prefer."+field, validation.CodeInvalidValue,
+			"must be one of: target, source")
+	}
+	return v.Err()
+}
@@ -0,0 +1,163 @@
+package enricher
+
+import (
+	"effective-mobile-test-task/internal/model"
+	"effective-mobile-test-task/internal/types"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// datasetRecord запись JSON-набора данных:
+// {"name": "Ivan", "age": 38.5, "age_count": 1200, "genders": {"male": 0.99, "female": 0.01},
+// "gender_count": 1500, "countries": {"RU": 0.6, "UA": 0.2}, "country_count": 1500}
+type datasetRecord struct {
+	Name         string             `json:"name"`
+	Age          *float64           `json:"age"`
+	AgeCount     uint               `json:"age_count"`
+	Genders      map[string]float64 `json:"genders"`
+	GenderCount  uint               `json:"gender_count"`
+	Countries    map[string]float64 `json:"countries"`
+	CountryCount uint               `json:"country_count"`
+}
+
+// csvColumns колонки CSV-набора данных. Распределения записываются как "male:0.99;female:0.01",
+// пустые значения допустимы
+var csvColumns = []string{"name", "age", "age_count", "genders", "gender_count", "countries", "country_count"}
+
+// LoadDataset читает статистику имен из файла .json (массив записей) или .csv (с заголовком csvColumns)
+func LoadDataset(path string) ([]model.NameStats, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var records []datasetRecord
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		err = json.NewDecoder(f).Decode(&records)
+	case ".csv":
+		records, err = readCSV(f)
+	default:
+		return nil, fmt.Errorf("unsupported dataset format %q, expected .json or .csv", filepath.Ext(path))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read dataset %s: %w", path, err)
+	}
+
+	stats := make([]model.NameStats, 0, len(records))
+	for i, r := range records {
+		if r.Name == "" {
+			return nil, fmt.Errorf("dataset %s: record %d has no name", path, i)
+		}
+		s := model.NameStats{
+			Name:         r.Name,
+			MeanAge:      r.Age,
+			AgeCount:     r.AgeCount,
+			Genders:      make(map[types.Gender]float64, len(r.Genders)),
+			GenderCount:  r.GenderCount,
+			Countries:    make(map[types.CountryID]float64, len(r.Countries)),
+			CountryCount: r.CountryCount,
+		}
+		for g, p := range r.Genders {
+			s.Genders[types.Gender(g)] = p
+		}
+		for c, p := range r.Countries {
+			s.Countries[types.CountryID(strings.ToUpper(c))] = p
+		}
+		stats = append(stats, s)
+	}
+
+	return stats, nil
+}
+
+func readCSV(r io.Reader) ([]datasetRecord, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = len(csvColumns)
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, err
+	}
+	for i, column := range csvColumns {
+		if strings.TrimSpace(header[i]) != column {
+			return nil, fmt.Errorf("expected header %s", strings.Join(csvColumns, ","))
+		}
+	}
+
+	var records []datasetRecord
+	for {
+		row, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return records, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		line, _ := cr.FieldPos(0)
+		rec := datasetRecord{Name: strings.TrimSpace(row[0])}
+		if v := strings.TrimSpace(row[1]); v != "" {
+			age, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: age must be a number: %w", line, err)
+			}
+			rec.Age = &age
+		}
+		if rec.AgeCount, err = parseCount(row[2]); err != nil {
+			return nil, fmt.Errorf("line %d: age_count: %w", line, err)
+		}
+		if rec.Genders, err = parseDistribution(row[3]); err != nil {
+			return nil, fmt.Errorf("line %d: genders: %w", line, err)
+		}
+		if rec.GenderCount, err = parseCount(row[4]); err != nil {
+			return nil, fmt.Errorf("line %d: gender_count: %w", line, err)
+		}
+		if rec.Countries, err = parseDistribution(row[5]); err != nil {
+			return nil, fmt.Errorf("line %d: countries: %w", line, err)
+		}
+		if rec.CountryCount, err = parseCount(row[6]); err != nil {
+			return nil, fmt.Errorf("line %d: country_count: %w", line, err)
+		}
+		records = append(records, rec)
+	}
+}
+
+func parseCount(value string) (uint, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.ParseUint(value, 10, 0)
+	if err != nil {
+		return 0, fmt.Errorf("must be a positive number: %w", err)
+	}
+	return uint(n), nil
+}
+
+// parseDistribution разбирает распределение вида "male:0.99;female:0.01"
+func parseDistribution(value string) (map[string]float64, error) {
+	dist := map[string]float64{}
+	for _, part := range strings.Split(value, ";") {
+		if part = strings.TrimSpace(part); part == "" {
+			continue
+		}
+		key, share, ok := strings.Cut(part, ":")
+		if !ok {
+			return nil, fmt.Errorf("%q must be in key:probability format", part)
+		}
+		p, err := strconv.ParseFloat(strings.TrimSpace(share), 64)
+		if err != nil || p < 0 || p > 1 {
+			return nil, fmt.Errorf("probability of %q must be between 0 and 1", key)
+		}
+		dist[strings.TrimSpace(key)] = p
+	}
+	return dist, nil
+}
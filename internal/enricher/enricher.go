@@ -0,0 +1,62 @@
+package enricher
+
+import (
+	"context"
+	"effective-mobile-test-task/internal/httpclient"
+	"effective-mobile-test-task/internal/model"
+	"time"
+)
+
+type (
+	// Enricher источник данных для обогащения пользователей по имени
+	Enricher interface {
+		// Name название источника, записывается в происхождение заполненных значений
+		Name() string
+		// Fields поля пользователя из model.EnrichableFields, которые заполняет источник
+		Fields() []string
+		// Enrich возвращает обогащения в порядке names, nil - у источника нет данных по имени.
+		// Значения ниже порога достоверности остаются пустыми, а причина записывается в Review
+		Enrich(ctx context.Context, names []string) ([]*model.UserEnrichment, error)
+	}
+	// PredictorEnricher адаптирует клиент API предсказаний к Enricher
+	PredictorEnricher[T httpclient.PredictorResponse] struct {
+		name      string
+		fields    []string
+		predictor httpclient.Predictor[T]
+		threshold httpclient.ConfidenceThreshold
+		convert   func(res T, threshold httpclient.ConfidenceThreshold, e *model.UserEnrichment)
+	}
+)
+
+func (pe *PredictorEnricher[T]) Name() string {
+	return pe.name
+}
+
+func (pe *PredictorEnricher[T]) Fields() []string {
+	return pe.fields
+}
+
+func (pe *PredictorEnricher[T]) Enrich(ctx context.Context, names []string) ([]*model.UserEnrichment, error) {
+	res, err := pe.predictor.PredictBatch(ctx, names)
+	if err != nil {
+		return nil, err
+	}
+
+	predicted := model.FieldProvenance{Kind: model.ProvenancePredicted, Source: pe.name, SetAt: time.Now().UTC()}
+	enrichments := make([]*model.UserEnrichment, len(res))
+	for i, r := range res {
+		if !r.Known() {
+			continue
+		}
+		e := &model.UserEnrichment{Review: map[string]string{}, Provenance: model.Provenance{}}
+		pe.convert(r, pe.threshold, e)
+		for _, field := range pe.fields {
+			if e.HasValue(field) {
+				e.Provenance[field] = predicted
+			}
+		}
+		enrichments[i] = e
+	}
+
+	return enrichments, nil
+}
@@ -0,0 +1,296 @@
+package enricher
+
+import (
+	"context"
+	"effective-mobile-test-task/internal/apperror"
+	"effective-mobile-test-task/internal/httpclient"
+	"effective-mobile-test-task/internal/model"
+	"effective-mobile-test-task/internal/types"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// Offline название офлайн-источника в происхождении значений
+const Offline = "offline"
+
+const (
+	// OfflineDisabled офлайн-источник не используется
+	OfflineDisabled = "disabled"
+	// OfflineFallback офлайн-источник заполняет поля, по которым API не дали значения
+	OfflineFallback = "fallback"
+	// OfflinePrimary значения офлайн-источника важнее ответов API
+	OfflinePrimary = "primary"
+)
+
+type (
+	// OfflineConfig настройки офлайн-источника. Статистика берется из файла DatasetPath
+	// и/или строится по пользователям с заданными вручную или импортированными значениями
+	// (FromUsers). Если заданы оба источника, статистика по одному имени объединяется
+	// с весами по размерам выборок
+	OfflineConfig struct {
+		Mode        string
+		DatasetPath string
+		FromUsers   bool
+		Threshold   httpclient.ConfidenceThreshold
+	}
+	// NameStatsSource источник статистики имен по пользователям сервиса
+	NameStatsSource interface {
+		NameStatistics(ctx context.Context) ([]model.NameStats, error)
+	}
+	// OfflineEnricher предсказывает возраст, пол и страну по заранее собранной статистике имен
+	// без обращения к внешним API. Статистику можно перезагрузить через Reload
+	OfflineEnricher struct {
+		mu        sync.RWMutex
+		stats     map[string]model.NameStats
+		threshold httpclient.ConfidenceThreshold
+		cfg       OfflineConfig
+		users     NameStatsSource
+	}
+)
+
+func (c *OfflineConfig) Validate() error {
+	if c.Mode == "" {
+		c.Mode = OfflineDisabled
+	}
+	switch c.Mode {
+	case OfflineDisabled:
+		return nil
+	case OfflineFallback, OfflinePrimary:
+	default:
+		return fmt.Errorf("offline mode must be one of %s, %s, %s", OfflineDisabled, OfflineFallback, OfflinePrimary)
+	}
+	if c.DatasetPath == "" && !c.FromUsers {
+		return fmt.Errorf("offline enricher requires a dataset path or statistics from users")
+	}
+	if c.Threshold.MinProbability < 0 || c.Threshold.MinProbability > 1 {
+		return fmt.Errorf("min probability must be between 0 and 1")
+	}
+	return nil
+}
+
+// LoadOfflineEnricher создает источник и загружает статистику из источников, заданных в cfg:
+// файла и статистики пользователей. Записи с одинаковым именем объединяются, см. mergeStats
+func LoadOfflineEnricher(ctx context.Context, cfg OfflineConfig, users NameStatsSource) (*OfflineEnricher, error) {
+	if cfg.FromUsers && users == nil {
+		return nil, apperror.NewAppError("LoadOfflineEnricher", "users statistics source is required", nil)
+	}
+
+	oe := &OfflineEnricher{threshold: cfg.Threshold, cfg: cfg, users: users}
+	if err := oe.Reload(ctx); err != nil {
+		return nil, err
+	}
+	return oe, nil
+}
+
+// Reload заново загружает статистику из источников, заданных при LoadOfflineEnricher.
+// При ошибке остается прежняя статистика
+func (oe *OfflineEnricher) Reload(ctx context.Context) error {
+	log := zerolog.Ctx(ctx).With().Str("method", "OfflineEnricher.Reload").Logger()
+
+	var stats []model.NameStats
+	if oe.cfg.DatasetPath != "" {
+		dataset, err := LoadDataset(oe.cfg.DatasetPath)
+		if err != nil {
+			return apperror.NewAppError("OfflineEnricher.Reload", "failed to load dataset", err)
+		}
+		log.Info().Str("path", oe.cfg.DatasetPath).Int("names", len(dataset)).Msg("offline dataset loaded")
+		stats = append(stats, dataset...)
+	}
+	if oe.cfg.FromUsers {
+		fromUsers, err := oe.users.NameStatistics(ctx)
+		if err != nil {
+			return err
+		}
+		log.Info().Int("names", len(fromUsers)).Msg("offline statistics built from users")
+		stats = append(stats, fromUsers...)
+	}
+
+	byName := indexStats(stats)
+	oe.mu.Lock()
+	oe.stats = byName
+	oe.mu.Unlock()
+
+	return nil
+}
+
+func (oe *OfflineEnricher) Name() string {
+	return Offline
+}
+
+func (oe *OfflineEnricher) Fields() []string {
+	return model.EnrichableFields
+}
+
+// Len количество имен в статистике
+func (oe *OfflineEnricher) Len() int {
+	oe.mu.RLock()
+	defer oe.mu.RUnlock()
+	return len(oe.stats)
+}
+
+func (oe *OfflineEnricher) Enrich(_ context.Context, names []string) ([]*model.UserEnrichment, error) {
+	predicted := model.FieldProvenance{Kind: model.ProvenancePredicted, Source: Offline, SetAt: time.Now().UTC()}
+
+	oe.mu.RLock()
+	stats := oe.stats
+	oe.mu.RUnlock()
+
+	enrichments := make([]*model.UserEnrichment, len(names))
+	for i, name := range names {
+		s, ok := stats[nameKey(name)]
+		if !ok {
+			continue
+		}
+		e := &model.UserEnrichment{Review: map[string]string{}, Provenance: model.Provenance{}}
+		oe.enrichAge(&s, e)
+		oe.enrichGender(&s, e)
+		oe.enrichCountry(&s, e)
+		for _, field := range model.EnrichableFields {
+			if e.HasValue(field) {
+				e.Provenance[field] = predicted
+			}
+		}
+		enrichments[i] = e
+	}
+
+	return enrichments, nil
+}
+
+func (oe *OfflineEnricher) enrichAge(s *model.NameStats, e *model.UserEnrichment) {
+	if s.MeanAge == nil {
+		return
+	}
+	e.AgeCount = sampleCount(s.AgeCount)
+	if err := oe.threshold.Check(nil, s.AgeCount); err != nil {
+		e.Review[model.Age] = err.Error()
+		return
+	}
+	age := types.Age(math.Round(*s.MeanAge))
+	e.Age = &age
+}
+
+func (oe *OfflineEnricher) enrichGender(s *model.NameStats, e *model.UserEnrichment) {
+	if len(s.Genders) == 0 {
+		return
+	}
+	genders := make([]types.Gender, 0, len(s.Genders))
+	for g := range s.Genders {
+		genders = append(genders, g)
+	}
+	slices.SortFunc(genders, func(a, b types.Gender) int {
+		return byShare(s.Genders[a], s.Genders[b], string(a), string(b))
+	})
+
+	gender := genders[0]
+	probability := s.Genders[gender]
+	e.GenderProbability = (*types.Probability)(&probability)
+	e.GenderCount = sampleCount(s.GenderCount)
+	if err := oe.threshold.Check(&probability, s.GenderCount); err != nil {
+		e.Review[model.Gender] = err.Error()
+		return
+	}
+	e.Gender = &gender
+}
+
+func (oe *OfflineEnricher) enrichCountry(s *model.NameStats, e *model.UserEnrichment) {
+	if len(s.Countries) == 0 {
+		return
+	}
+	for c, p := range s.Countries {
+		e.Countries = append(e.Countries, model.CountryProbability{CountryID: c, Probability: types.Probability(p)})
+	}
+	slices.SortFunc(e.Countries, func(a, b model.CountryProbability) int {
+		return byShare(float64(a.Probability), float64(b.Probability), string(a.CountryID), string(b.CountryID))
+	})
+
+	top := e.Countries[0]
+	probability := float64(top.Probability)
+	e.CountryProbability = &top.Probability
+	e.CountryCount = sampleCount(s.CountryCount)
+	if err := oe.threshold.Check(&probability, s.CountryCount); err != nil {
+		e.Review[model.CountryId] = err.Error()
+		return
+	}
+	e.CountryID = &top.CountryID
+}
+
+// indexStats группирует статистику по имени, объединяя записи с одинаковым именем
+func indexStats(stats []model.NameStats) map[string]model.NameStats {
+	byName := make(map[string]model.NameStats, len(stats))
+	for _, s := range stats {
+		key := nameKey(s.Name)
+		if prev, ok := byName[key]; ok {
+			s = mergeStats(prev, s)
+		}
+		byName[key] = s
+	}
+	return byName
+}
+
+// mergeStats объединяет статистику одного имени из разных источников. Средний возраст
+// и распределения взвешиваются по размерам выборок, а размеры выборок складываются.
+// Запись без размера выборки учитывается как одно наблюдение
+func mergeStats(a, b model.NameStats) model.NameStats {
+	merged := model.NameStats{Name: a.Name}
+
+	switch {
+	case a.MeanAge == nil:
+		merged.MeanAge, merged.AgeCount = b.MeanAge, b.AgeCount
+	case b.MeanAge == nil:
+		merged.MeanAge, merged.AgeCount = a.MeanAge, a.AgeCount
+	default:
+		wa, wb := sampleWeight(a.AgeCount), sampleWeight(b.AgeCount)
+		mean := (*a.MeanAge*wa + *b.MeanAge*wb) / (wa + wb)
+		merged.MeanAge, merged.AgeCount = &mean, a.AgeCount+b.AgeCount
+	}
+
+	merged.Genders, merged.GenderCount = mergeShares(a.Genders, a.GenderCount, b.Genders, b.GenderCount)
+	merged.Countries, merged.CountryCount = mergeShares(a.Countries, a.CountryCount, b.Countries, b.CountryCount)
+
+	return merged
+}
+
+// mergeShares объединяет два распределения долей с весами по размерам выборок
+func mergeShares[K comparable](a map[K]float64, countA uint, b map[K]float64, countB uint) (map[K]float64, uint) {
+	if len(a) == 0 {
+		return b, countB
+	}
+	if len(b) == 0 {
+		return a, countA
+	}
+
+	wa, wb := sampleWeight(countA), sampleWeight(countB)
+	merged := make(map[K]float64, len(a)+len(b))
+	for k, p := range a {
+		merged[k] += p * wa / (wa + wb)
+	}
+	for k, p := range b {
+		merged[k] += p * wb / (wa + wb)
+	}
+	return merged, countA + countB
+}
+
+func sampleWeight(count uint) float64 {
+	return float64(max(count, 1))
+}
+
+// byShare упорядочивает значения распределения по убыванию доли, равные доли - по ключу
+func byShare(a, b float64, keyA, keyB string) int {
+	switch {
+	case a > b:
+		return -1
+	case a < b:
+		return 1
+	}
+	return strings.Compare(keyA, keyB)
+}
+
+func nameKey(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
@@ -0,0 +1,75 @@
+package enricher
+
+import (
+	"effective-mobile-test-task/internal/httpclient"
+	"effective-mobile-test-task/internal/model"
+	"effective-mobile-test-task/internal/types"
+)
+
+// NewAgifyEnricher заполняет возраст по ответам agify
+func NewAgifyEnricher(predictor httpclient.Predictor[httpclient.AgifyResponse], threshold httpclient.ConfidenceThreshold) *PredictorEnricher[httpclient.AgifyResponse] {
+	return &PredictorEnricher[httpclient.AgifyResponse]{
+		name:      string(httpclient.Agify),
+		fields:    []string{model.Age},
+		predictor: predictor,
+		threshold: threshold,
+		convert: func(res httpclient.AgifyResponse, threshold httpclient.ConfidenceThreshold, e *model.UserEnrichment) {
+			e.AgeCount = sampleCount(res.Count)
+			if err := threshold.Check(nil, res.Count); err != nil {
+				e.Review[model.Age] = err.Error()
+				return
+			}
+			e.Age = (*types.Age)(&res.Age)
+		},
+	}
+}
+
+// NewGenderizeEnricher заполняет пол по ответам genderize
+func NewGenderizeEnricher(predictor httpclient.Predictor[httpclient.GenderizeResponse], threshold httpclient.ConfidenceThreshold) *PredictorEnricher[httpclient.GenderizeResponse] {
+	return &PredictorEnricher[httpclient.GenderizeResponse]{
+		name:      string(httpclient.Genderize),
+		fields:    []string{model.Gender},
+		predictor: predictor,
+		threshold: threshold,
+		convert: func(res httpclient.GenderizeResponse, threshold httpclient.ConfidenceThreshold, e *model.UserEnrichment) {
+			e.GenderProbability = (*types.Probability)(&res.Probability)
+			e.GenderCount = sampleCount(res.Count)
+			if err := threshold.Check(&res.Probability, res.Count); err != nil {
+				e.Review[model.Gender] = err.Error()
+				return
+			}
+			e.Gender = (*types.Gender)(&res.Gender)
+		},
+	}
+}
+
+// NewNationalizeEnricher заполняет страну по ответам nationalize вместе со списком всех предсказанных стран
+func NewNationalizeEnricher(predictor httpclient.Predictor[httpclient.NationalizeResponse], threshold httpclient.ConfidenceThreshold) *PredictorEnricher[httpclient.NationalizeResponse] {
+	return &PredictorEnricher[httpclient.NationalizeResponse]{
+		name:      string(httpclient.Nationalize),
+		fields:    []string{model.CountryId},
+		predictor: predictor,
+		threshold: threshold,
+		convert: func(res httpclient.NationalizeResponse, threshold httpclient.ConfidenceThreshold, e *model.UserEnrichment) {
+			top := res.Countries[0]
+			e.CountryProbability = (*types.Probability)(&top.Probability)
+			e.CountryCount = sampleCount(res.Count)
+			for _, c := range res.Countries {
+				e.Countries = append(e.Countries, model.CountryProbability{
+					CountryID:   types.CountryID(c.CountryId),
+					Probability: types.Probability(c.Probability),
+				})
+			}
+			if err := threshold.Check(&top.Probability, res.Count); err != nil {
+				e.Review[model.CountryId] = err.Error()
+				return
+			}
+			e.CountryID = (*types.CountryID)(&top.CountryId)
+		},
+	}
+}
+
+func sampleCount(count uint) *types.SampleCount {
+	c := types.SampleCount(count)
+	return &c
+}
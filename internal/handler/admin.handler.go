@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"effective-mobile-test-task/internal/apperror"
+	"effective-mobile-test-task/internal/dto"
+	"effective-mobile-test-task/internal/httpclient"
+	"effective-mobile-test-task/internal/service"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// QuotaReporter API, квоту которого можно посмотреть через админ API
+type QuotaReporter interface {
+	Name() httpclient.APIType
+	Quota() httpclient.QuotaState
+}
+
+type AdminHandler struct {
+	enrichmentService *service.EnrichmentService
+	quotas            []QuotaReporter
+}
+
+func NewAdminHandler(enrichmentService *service.EnrichmentService, quotas ...QuotaReporter) (*AdminHandler, error) {
+	if enrichmentService == nil {
+		return nil, apperror.NewAppError("NewAdminHandler", "enrichmentService is required", nil)
+	}
+
+	return &AdminHandler{enrichmentService: enrichmentService, quotas: quotas}, nil
+}
+
+func (ah *AdminHandler) Routes() http.Handler {
+	r := chi.NewRouter()
+
+	r.Post("/enrichment/requeue", ah.RequeueEnrichment)
+	r.Get("/quota", ah.Quota)
+
+	return r
+}
+
+// RequeueEnrichment godoc
+// @Summary Повторное обогащение пользователей
+// @Description Ставит в очередь обогащения всех пользователей, у которых не заполнен возраст, пол или страна. Пользователи, уже находящиеся в очереди, пропускаются
+// @Tags admin
+// @Produce json
+// @Success 200 {object} dto.ResponseDTO{payload=dto.EnrichmentRequeuePayload}
+// @Failure 500 {object} dto.ErrorResponseDTO
+// @Router /admin/enrichment/requeue [post]
+func (ah *AdminHandler) RequeueEnrichment(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	result, err := ah.enrichmentService.RequeueIncomplete(ctx)
+	if err != nil {
+		errorResponse(ctx, w, err)
+		return
+	}
+
+	successResponse(ctx, w, 200, result)
+}
+
+// Quota godoc
+// @Summary Квоты публичных API
+// @Description Последнее известное состояние квоты каждого API по заголовкам X-Rate-Limit-*. При остатке не больше резерва запросы к API приостанавливаются до восстановления квоты
+// @Tags admin
+// @Produce json
+// @Success 200 {object} dto.ResponseDTO{payload=[]dto.QuotaPayload}
+// @Router /admin/quota [get]
+func (ah *AdminHandler) Quota(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	payload := make([]dto.QuotaPayload, 0, len(ah.quotas))
+	for _, q := range ah.quotas {
+		state := q.Quota()
+		payload = append(payload, dto.QuotaPayload{
+			Provider:  string(q.Name()),
+			Limit:     state.Limit,
+			Remaining: state.Remaining,
+			Reserve:   state.Reserve,
+			ResetAt:   state.ResetAt,
+			UpdatedAt: state.UpdatedAt,
+			Throttled: state.Throttled,
+		})
+	}
+
+	successResponse(ctx, w, 200, payload)
+}
@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"context"
+	"effective-mobile-test-task/internal/apperror"
+	"effective-mobile-test-task/internal/dto"
+	"effective-mobile-test-task/internal/httpclient"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+type (
+	Pinger interface {
+		PingContext(ctx context.Context) error
+	}
+	PredictorStatus interface {
+		Name() httpclient.APIType
+		BreakerState() httpclient.BreakerState
+	}
+)
+
+const (
+	HealthOK       = "ok"
+	HealthDegraded = "degraded"
+	HealthDown     = "down"
+)
+
+type HealthHandler struct {
+	db         Pinger
+	predictors []PredictorStatus
+}
+
+func NewHealthHandler(db Pinger, predictors ...PredictorStatus) (*HealthHandler, error) {
+	if db == nil {
+		return nil, apperror.NewAppError("NewHealthHandler", "db is required", nil)
+	}
+
+	return &HealthHandler{db: db, predictors: predictors}, nil
+}
+
+// Health godoc
+// @Summary Состояние сервиса
+// @Description Проверка подключения к БД и состояния circuit breaker публичных API. При недоступной БД возвращается 503
+// @Tags health
+// @Produce json
+// @Success 200 {object} dto.ResponseDTO{payload=dto.HealthPayload}
+// @Failure 503 {object} dto.ResponseDTO{payload=dto.HealthPayload}
+// @Router /health [get]
+func (hh *HealthHandler) Health(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	log := zerolog.Ctx(ctx).With().Str("method", "HealthHandler.Health").Logger()
+
+	payload := dto.HealthPayload{
+		Status:     HealthOK,
+		Database:   HealthOK,
+		Predictors: make(map[string]string, len(hh.predictors)),
+	}
+
+	pingCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	if err := hh.db.PingContext(pingCtx); err != nil {
+		log.Error().Err(err).Msg("database ping failed")
+		payload.Database = HealthDown
+		payload.Status = HealthDown
+	}
+
+	for _, p := range hh.predictors {
+		state := p.BreakerState()
+		payload.Predictors[string(p.Name())] = string(state)
+		if state != httpclient.BreakerClosed && payload.Status == HealthOK {
+			payload.Status = HealthDegraded
+		}
+	}
+
+	if payload.Status == HealthDown {
+		respond(ctx, w, http.StatusServiceUnavailable, dto.ResponseDTO{Success: false, Payload: payload})
+		return
+	}
+	successResponse(ctx, w, http.StatusOK, payload)
+}
@@ -2,10 +2,16 @@ package handler
 
 import (
 	"context"
+	"crypto/sha256"
 	"effective-mobile-test-task/internal/apperror"
 	"effective-mobile-test-task/internal/dto"
+	"effective-mobile-test-task/internal/types"
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/rs/zerolog"
 )
@@ -15,11 +21,19 @@ func errorResponse(ctx context.Context, w http.ResponseWriter, err error) {
 
 	statusCode := http.StatusInternalServerError
 	message := "internal server error"
+	code := apperror.CodeInternal
+	var details []dto.ErrorDetailPayload
+	var meta map[string]interface{}
 
 	switch e := err.(type) {
 	case *apperror.HttpError:
 		statusCode = e.Code
 		message = e.Message
+		code = e.ErrorCode
+		meta = e.Meta
+		for _, d := range e.Details {
+			details = append(details, dto.ErrorDetailPayload{Field: d.Field, Code: d.Code, Message: d.Message})
+		}
 	case *apperror.AppError:
 		log.Error().
 			Str("method", e.Method).
@@ -32,7 +46,10 @@ func errorResponse(ctx context.Context, w http.ResponseWriter, err error) {
 	}
 
 	payload := dto.ErrorPayload{
+		Code:    code,
 		Message: message,
+		Details: details,
+		Meta:    meta,
 	}
 
 	resp := dto.ErrorResponseDTO{
@@ -69,3 +86,100 @@ func respond[T dto.Response](ctx context.Context, w http.ResponseWriter, statusC
 			Msg("failed to write JSON success response")
 	}
 }
+
+// formList собирает значения query параметра, переданного несколько раз
+// или через запятую: ?gender=male&gender=female или ?gender=male,female
+func formList(r *http.Request, key string) []string {
+	if err := r.ParseForm(); err != nil {
+		return nil
+	}
+
+	var values []string
+	for _, raw := range r.Form[key] {
+		for _, v := range strings.Split(raw, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, v)
+			}
+		}
+	}
+	return values
+}
+
+// formTime разбирает дату в формате RFC3339 или YYYY-MM-DD. Для верхней границы
+// диапазона дата без времени означает конец указанного дня
+func formTime(r *http.Request, key string, endOfDay bool) (*time.Time, error) {
+	value := r.FormValue(key)
+	if value == "" {
+		return nil, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return &t, nil
+	}
+
+	t, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return nil, apperror.NewHttpError(400, fmt.Sprintf("%s must be a date in RFC3339 or YYYY-MM-DD format", key))
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1).Add(-time.Microsecond)
+	}
+	return &t, nil
+}
+
+// noCache клиент просит не использовать кэш предсказаний (Cache-Control: no-cache)
+func noCache(r *http.Request) bool {
+	for _, directive := range strings.Split(r.Header.Get("Cache-Control"), ",") {
+		if strings.EqualFold(strings.TrimSpace(directive), "no-cache") {
+			return true
+		}
+	}
+	return false
+}
+
+// etag формирует ETag для версии пользователя
+func etag(version types.Version) string {
+	return fmt.Sprintf(`"%d"`, version)
+}
+
+// listETag формирует слабый ETag для списка пользователей по их ID и версиям
+func listETag(users []dto.UserPayload) string {
+	h := sha256.New()
+	for _, u := range users {
+		fmt.Fprintf(h, "%s:%d;", u.UUID, u.Version)
+	}
+	return fmt.Sprintf(`W/"%x"`, h.Sum(nil)[:16])
+}
+
+// ifMatch возвращает версии из заголовка If-Match (RFC 9110): список ETag через запятую.
+// If-Match использует строгое сравнение, поэтому слабые ETag (W/) никогда не совпадают.
+// nil - заголовок не передан или содержит "*". Пустой список - ни один ETag не может
+// совпасть с версией пользователя
+func ifMatch(r *http.Request) ([]types.Version, error) {
+	header := strings.Join(r.Header.Values("If-Match"), ",")
+	if strings.TrimSpace(header) == "" {
+		return nil, nil
+	}
+
+	versions := make([]types.Version, 0)
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return nil, nil
+		}
+		weak := strings.HasPrefix(tag, "W/")
+		tag = strings.TrimPrefix(tag, "W/")
+		if len(tag) < 2 || !strings.HasPrefix(tag, `"`) || !strings.HasSuffix(tag, `"`) {
+			return nil, apperror.NewHttpError(400, "If-Match must be \"*\" or a list of ETags")
+		}
+		if weak {
+			continue
+		}
+		version, err := strconv.ParseInt(strings.Trim(tag, `"`), 10, 64)
+		if err != nil {
+			continue
+		}
+		versions = append(versions, types.Version(version))
+	}
+	return versions, nil
+}
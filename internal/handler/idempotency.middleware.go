@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"effective-mobile-test-task/internal/apperror"
+	"effective-mobile-test-task/internal/service"
+	"io"
+	"net/http"
+
+	"github.com/rs/zerolog"
+)
+
+// responseRecorder передает ответ клиенту и сохраняет его копию
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rr *responseRecorder) WriteHeader(status int) {
+	rr.status = status
+	rr.ResponseWriter.WriteHeader(status)
+}
+
+func (rr *responseRecorder) Write(b []byte) (int, error) {
+	if rr.status == 0 {
+		rr.status = http.StatusOK
+	}
+	rr.body.Write(b)
+	return rr.ResponseWriter.Write(b)
+}
+
+// idempotent обрабатывает заголовок Idempotency-Key: первый запрос выполняется и его ответ
+// сохраняется, повтор с тем же ключом и тем же запросом получает сохраненный ответ
+// с заголовком Idempotent-Replayed. Запросы без заголовка выполняются как обычно
+func idempotent(idempotencyService *service.IdempotencyService, scope string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		log := zerolog.Ctx(ctx).With().Str("method", "idempotent").Logger()
+
+		key := r.Header.Get("Idempotency-Key")
+		if key == "" {
+			next(w, r)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			errorResponse(ctx, w, apperror.NewHttpError(400, "failed to read request body"))
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		// параметры запроса тоже влияют на результат, поэтому входят в отпечаток
+		request := append([]byte(r.URL.RawQuery+"\n"), body...)
+		saved, err := idempotencyService.Begin(ctx, scope, key, request)
+		if err != nil {
+			errorResponse(ctx, w, err)
+			return
+		}
+		if saved != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(*saved.StatusCode)
+			if _, err := w.Write(saved.Response); err != nil {
+				log.Error().Err(err).Msg("failed to write replayed response")
+			}
+			return
+		}
+
+		// ответ сохраняется, даже если клиент отключился, не дождавшись его
+		saveCtx := context.WithoutCancel(ctx)
+		rec := &responseRecorder{ResponseWriter: w}
+		defer func() {
+			if rec.status == 0 {
+				if err := idempotencyService.Release(saveCtx, scope, key); err != nil {
+					log.Error().Err(err).Str("key", key).Msg("failed to release idempotency key")
+				}
+				return
+			}
+			if err := idempotencyService.Finish(saveCtx, scope, key, rec.status, rec.body.Bytes()); err != nil {
+				log.Error().Err(err).Str("key", key).Msg("failed to save idempotent response")
+			}
+		}()
+
+		next(rec, r)
+	}
+}
@@ -2,36 +2,53 @@ package handler
 
 import (
 	"effective-mobile-test-task/internal/apperror"
+	"effective-mobile-test-task/internal/cache"
 	"effective-mobile-test-task/internal/dto"
 	"effective-mobile-test-task/internal/model"
+	"effective-mobile-test-task/internal/normalize"
 	"effective-mobile-test-task/internal/service"
 	"effective-mobile-test-task/internal/types"
+	"effective-mobile-test-task/internal/validation"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/go-chi/chi/v5"
 )
 
+const maxBatchSize = 5000
+
 type UserHandler struct {
-	userService *service.UserService
+	userService        *service.UserService
+	idempotencyService *service.IdempotencyService
 }
 
-func NewUserHandler(userService *service.UserService) (*UserHandler, error) {
+func NewUserHandler(userService *service.UserService, idempotencyService *service.IdempotencyService) (*UserHandler, error) {
 	if userService == nil {
 		return nil, apperror.NewAppError("NewUserHandler", "userService is required", nil)
 	}
+	if idempotencyService == nil {
+		return nil, apperror.NewAppError("NewUserHandler", "idempotencyService is required", nil)
+	}
 
-	return &UserHandler{userService: userService}, nil
+	return &UserHandler{userService: userService, idempotencyService: idempotencyService}, nil
 }
 
 func (uh *UserHandler) Routes() http.Handler {
 	r := chi.NewRouter()
 
 	r.Get("/", uh.FindUsers)
-	r.Post("/", uh.CreateUser)
+	r.Post("/", idempotent(uh.idempotencyService, "POST /users", uh.CreateUser))
+	r.Post("/batch", idempotent(uh.idempotencyService, "POST /users/batch", uh.CreateUsers))
+	r.Get("/{uuid}", uh.GetUser)
+	r.Get("/{uuid}/history", uh.GetUserHistory)
+	r.Put("/{uuid}", uh.ReplaceUser)
 	r.Patch("/{uuid}", uh.UpdateUser)
 	r.Delete("/{uuid}", uh.DeleteUser)
+	r.Post("/{uuid}/restore", uh.RestoreUser)
+	r.Post("/{uuid}/merge", uh.MergeUsers)
 
 	return r
 }
@@ -42,17 +59,32 @@ func (uh *UserHandler) Routes() http.Handler {
 // @Tags users
 // @Accept json
 // @Produce json
-// @Param page query int true "Номер страницы"
+// @Param page query int false "Номер страницы (обязателен, если не передан cursor)"
+// @Param cursor query string false "Курсор для постраничного вывода без OFFSET: пустое значение - первая страница, далее next_cursor из ответа"
 // @Param limit query int true "Количество записей на 1 странице"
-// @Param name query string false "Имя пользователя"
-// @Param surname query string false "Фамилия пользователя"
-// @Param patronymic query string false "Отчество пользователя"
+// @Param with_total query bool false "Считать ли общее количество записей (по умолчанию true для page и false для cursor)"
+// @Param include_deleted query bool false "Включать ли удаленных пользователей, ожидающих окончательного удаления (по умолчанию false)"
+// @Param q query string false "Поисковая строка по имени, фамилии и отчеству (префикс, подстрока, нечеткое совпадение). Без order_by в режиме page результаты сортируются по релевантности"
+// @Param name query string false "Имя пользователя в исходном написании или в транслитерации"
+// @Param surname query string false "Фамилия пользователя в исходном написании или в транслитерации"
+// @Param patronymic query string false "Отчество пользователя в исходном написании или в транслитерации"
 // @Param age query int false "Возраст пользователя"
-// @Param gender query string false "Пол пользователя"
-// @Param country_id query string false "Код страны пользователя"
+// @Param age_min query int false "Минимальный возраст пользователя (включительно)"
+// @Param age_max query int false "Максимальный возраст пользователя (включительно)"
+// @Param gender query []string false "Пол пользователя, можно передать несколько значений" collectionFormat(csv)
+// @Param country_id query []string false "Код страны пользователя, можно передать несколько значений" collectionFormat(csv)
+// @Param enrichment_status query []string false "Статус обогащения: pending, done, incomplete, needs_review, failed" collectionFormat(csv)
+// @Param min_age_count query int false "Минимальный размер выборки, по которой предсказан возраст"
+// @Param min_gender_probability query number false "Минимальная вероятность предсказанного пола (0..1)"
+// @Param min_country_probability query number false "Минимальная вероятность предсказанной страны (0..1)"
+// @Param created_from query string false "Дата создания от (RFC3339 или YYYY-MM-DD)"
+// @Param created_to query string false "Дата создания до включительно (RFC3339 или YYYY-MM-DD)"
+// @Param updated_from query string false "Дата обновления от (RFC3339 или YYYY-MM-DD)"
+// @Param updated_to query string false "Дата обновления до включительно (RFC3339 или YYYY-MM-DD)"
 // @Param order_by query string false "Поле для сортировки"
 // @Param order_dir query string false "Направление сортировки ASC, DESC"
 // @Success 200 {object} dto.ResponseDTO{payload=dto.ListOfUsersPayload}
+// @Header 200 {string} ETag "Слабый ETag страницы, меняется при изменении любого пользователя на ней"
 // @Failure 400 {object} dto.ErrorResponseDTO
 // @Failure 500 {object} dto.ErrorResponseDTO
 // @Router /users [get]
@@ -60,15 +92,36 @@ func (uh *UserHandler) FindUsers(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	uqo := &model.UserQueryOptions{}
 
+	if err := r.ParseForm(); err != nil {
+		errorResponse(ctx, w, apperror.NewHttpError(400, "invalid query parameters"))
+		return
+	}
+
+	_, hasCursor := r.Form["cursor"]
 	if page := r.FormValue("page"); page != "" {
+		if hasCursor {
+			errorResponse(ctx, w, apperror.NewHttpError(400, "page and cursor can't be used together"))
+			return
+		}
 		uint64Page, err := strconv.ParseUint(page, 10, 64)
 		if err != nil {
 			errorResponse(ctx, w, apperror.NewHttpError(400, "page must be a positive number"))
 			return
 		}
 		uqo.Page = types.Page(uint64Page)
+		uqo.WithTotal = true
+	} else if hasCursor {
+		uqo.Keyset = true
+		if cursor := r.FormValue("cursor"); cursor != "" {
+			after, err := model.DecodeCursor(types.Cursor(cursor))
+			if err != nil {
+				errorResponse(ctx, w, apperror.NewHttpError(400, err.Error()))
+				return
+			}
+			uqo.After = after
+		}
 	} else {
-		errorResponse(ctx, w, apperror.NewHttpError(400, "page is required"))
+		errorResponse(ctx, w, apperror.NewHttpError(400, "page or cursor is required"))
 		return
 	}
 	if limit := r.FormValue("limit"); limit != "" {
@@ -82,31 +135,133 @@ func (uh *UserHandler) FindUsers(w http.ResponseWriter, r *http.Request) {
 		errorResponse(ctx, w, apperror.NewHttpError(400, "limit is required"))
 		return
 	}
+	if withTotal := r.FormValue("with_total"); withTotal != "" {
+		boolWithTotal, err := strconv.ParseBool(withTotal)
+		if err != nil {
+			errorResponse(ctx, w, apperror.NewHttpError(400, "with_total must be a boolean"))
+			return
+		}
+		uqo.WithTotal = boolWithTotal
+	}
+	if includeDeleted := r.FormValue("include_deleted"); includeDeleted != "" {
+		boolIncludeDeleted, err := strconv.ParseBool(includeDeleted)
+		if err != nil {
+			errorResponse(ctx, w, apperror.NewHttpError(400, "include_deleted must be a boolean"))
+			return
+		}
+		uqo.Filter.IncludeDeleted = boolIncludeDeleted
+	}
 
-	if name := r.FormValue("name"); name != "" {
+	if q := strings.TrimSpace(r.FormValue("q")); q != "" {
+		uqo.Filter.Query = (*types.SearchQuery)(&q)
+	}
+	// ФИО сравнивается с нормализованными значениями в БД
+	if name := normalize.Name(r.FormValue("name")); name != "" {
 		uqo.Filter.Name = (*types.Name)(&name)
 	}
-	if surname := r.FormValue("surname"); surname != "" {
+	if surname := normalize.Name(r.FormValue("surname")); surname != "" {
 		uqo.Filter.Surname = (*types.Surname)(&surname)
 	}
-	if patronymic := r.FormValue("patronymic"); patronymic != "" {
+	if patronymic := normalize.Name(r.FormValue("patronymic")); patronymic != "" {
 		uqo.Filter.Patronymic = (*types.Patronymic)(&patronymic)
 	}
+	// значения фильтров проверяются теми же правилами, что и поля пользователя
+	v := &validation.Validator{}
 	if age := r.FormValue("age"); age != "" {
 		uintAge, err := strconv.ParseUint(age, 10, 0)
 		if err != nil {
 			errorResponse(ctx, w, apperror.NewHttpError(400, "age must be a positive number"))
 			return
 		}
+		v.Age("age", uintAge)
 		uqo.Filter.Age = (*types.Age)(&uintAge)
 	}
-	if gender := r.FormValue("gender"); gender != "" {
-		uqo.Filter.Gender = (*types.Gender)(&gender)
+	if ageMin := r.FormValue("age_min"); ageMin != "" {
+		uintAgeMin, err := strconv.ParseUint(ageMin, 10, 0)
+		if err != nil {
+			errorResponse(ctx, w, apperror.NewHttpError(400, "age_min must be a positive number"))
+			return
+		}
+		v.Age("age_min", uintAgeMin)
+		uqo.Filter.AgeMin = (*types.Age)(&uintAgeMin)
+	}
+	if ageMax := r.FormValue("age_max"); ageMax != "" {
+		uintAgeMax, err := strconv.ParseUint(ageMax, 10, 0)
+		if err != nil {
+			errorResponse(ctx, w, apperror.NewHttpError(400, "age_max must be a positive number"))
+			return
+		}
+		v.Age("age_max", uintAgeMax)
+		uqo.Filter.AgeMax = (*types.Age)(&uintAgeMax)
+	}
+	for _, gender := range formList(r, "gender") {
+		v.Gender("gender", gender)
+		uqo.Filter.Genders = append(uqo.Filter.Genders, types.Gender(gender))
+	}
+	for _, countryID := range formList(r, "country_id") {
+		v.CountryID("country_id", countryID)
+		uqo.Filter.CountryIDs = append(uqo.Filter.CountryIDs, types.CountryID(countryID))
+	}
+	if err := v.Err(); err != nil {
+		errorResponse(ctx, w, validation.HttpError(err))
+		return
+	}
+
+	for _, status := range formList(r, "enrichment_status") {
+		if !model.IsValidEnrichmentStatus(status) {
+			errorResponse(ctx, w, apperror.NewHttpError(400, "enrichment_status has invalid value"))
+			return
+		}
+		uqo.Filter.EnrichmentStatuses = append(uqo.Filter.EnrichmentStatuses, types.EnrichmentStatus(status))
+	}
+
+	if minAgeCount := r.FormValue("min_age_count"); minAgeCount != "" {
+		uintMinAgeCount, err := strconv.ParseUint(minAgeCount, 10, 64)
+		if err != nil {
+			errorResponse(ctx, w, apperror.NewHttpError(400, "min_age_count must be a positive number"))
+			return
+		}
+		uqo.Filter.MinAgeCount = (*types.SampleCount)(&uintMinAgeCount)
+	}
+	if minGenderProbability := r.FormValue("min_gender_probability"); minGenderProbability != "" {
+		floatMinGenderProbability, err := strconv.ParseFloat(minGenderProbability, 64)
+		if err != nil {
+			errorResponse(ctx, w, apperror.NewHttpError(400, "min_gender_probability must be a number"))
+			return
+		}
+		uqo.Filter.MinGenderProbability = (*types.Probability)(&floatMinGenderProbability)
+	}
+	if minCountryProbability := r.FormValue("min_country_probability"); minCountryProbability != "" {
+		floatMinCountryProbability, err := strconv.ParseFloat(minCountryProbability, 64)
+		if err != nil {
+			errorResponse(ctx, w, apperror.NewHttpError(400, "min_country_probability must be a number"))
+			return
+		}
+		uqo.Filter.MinCountryProbability = (*types.Probability)(&floatMinCountryProbability)
+	}
+
+	var err error
+	if uqo.Filter.CreatedFrom, err = formTime(r, "created_from", false); err != nil {
+		errorResponse(ctx, w, err)
+		return
 	}
-	if countryID := r.FormValue("country_id"); countryID != "" {
-		uqo.Filter.CountryID = (*types.CountryID)(&countryID)
+	if uqo.Filter.CreatedTo, err = formTime(r, "created_to", true); err != nil {
+		errorResponse(ctx, w, err)
+		return
+	}
+	if uqo.Filter.UpdatedFrom, err = formTime(r, "updated_from", false); err != nil {
+		errorResponse(ctx, w, err)
+		return
+	}
+	if uqo.Filter.UpdatedTo, err = formTime(r, "updated_to", true); err != nil {
+		errorResponse(ctx, w, err)
+		return
 	}
 
+	if err := uqo.Filter.Validate(); err != nil {
+		errorResponse(ctx, w, apperror.NewHttpError(400, err.Error()))
+		return
+	}
 	if orderBy := r.FormValue("order_by"); orderBy != "" {
 		if uqo.IsValidOrderBy(orderBy) {
 			uqo.OrderBy = (*types.OrderBy)(&orderBy)
@@ -124,26 +279,101 @@ func (uh *UserHandler) FindUsers(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	if err := uqo.ValidateCursor(); err != nil {
+		errorResponse(ctx, w, apperror.NewHttpError(400, err.Error()))
+		return
+	}
+
 	usersList, err := uh.userService.FindUsers(ctx, uqo)
 	if err != nil {
 		errorResponse(ctx, w, err)
 		return
 	}
 
+	w.Header().Set("ETag", listETag(usersList.Users))
 	successResponse(ctx, w, 200, usersList)
 }
 
+// GetUser godoc
+// @Summary Получение пользователя
+// @Description Получение данных пользователя по переданному ID
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param uuid path string true "ID пользователя"
+// @Success 200 {object} dto.ResponseDTO{payload=dto.UserPayload}
+// @Header 200 {string} ETag "Версия пользователя для If-Match"
+// @Failure 400 {object} dto.ErrorResponseDTO
+// @Failure 404 {object} dto.ErrorResponseDTO
+// @Failure 500 {object} dto.ErrorResponseDTO
+// @Router /users/{uuid} [get]
+func (uh *UserHandler) GetUser(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	uuid := r.PathValue("uuid")
+	if uuid == "" {
+		errorResponse(ctx, w, apperror.NewHttpError(400, "uuid is empty"))
+		return
+	}
+
+	user, err := uh.userService.GetUser(ctx, types.UUID(uuid))
+	if err != nil {
+		errorResponse(ctx, w, err)
+		return
+	}
+
+	w.Header().Set("ETag", etag(user.Version))
+	successResponse(ctx, w, 200, user)
+}
+
+// GetUserHistory godoc
+// @Summary История изменений пользователя
+// @Description Получение всех изменений пользователя (создание, обновления, удаление) в порядке применения, в том числе для удаленного пользователя
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param uuid path string true "ID пользователя"
+// @Success 200 {object} dto.ResponseDTO{payload=dto.UserHistoryPayload}
+// @Failure 400 {object} dto.ErrorResponseDTO
+// @Failure 404 {object} dto.ErrorResponseDTO
+// @Failure 500 {object} dto.ErrorResponseDTO
+// @Router /users/{uuid}/history [get]
+func (uh *UserHandler) GetUserHistory(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	uuid := r.PathValue("uuid")
+	if uuid == "" {
+		errorResponse(ctx, w, apperror.NewHttpError(400, "uuid is empty"))
+		return
+	}
+
+	history, err := uh.userService.GetUserHistory(ctx, types.UUID(uuid))
+	if err != nil {
+		errorResponse(ctx, w, err)
+		return
+	}
+
+	successResponse(ctx, w, 200, history)
+}
+
 // CreateUser godoc
 // @Summary Создание пользователя
-// @Description Создание пользователя, данные будут обогащены с помощью публичных API
+// @Description Создание пользователя. ФИО нормализуется (пробелы, регистр, NFC) и сохраняется также в латинской транслитерации (ICAO), по которой запрашиваются предсказания. Возраст, пол и страна заполняются асинхронно с помощью публичных API, статус виден в поле enrichment_status. Переданные при создании age, gender и country_id сохраняются как импортированные и обогащением не перезаписываются
 // @Tags users
 // @Accept json
 // @Produce json
 // @Param name body string true "Имя пользователя"
 // @Param surname body string true "Фамилия пользователя"
 // @Param patronymic query string false "Отчество пользователя"
+// @Param on_duplicate query string false "Поведение при найденном пользователе с тем же ФИО: reject (по умолчанию) - ошибка 409 с existing_uuid, link - создать со ссылкой duplicate_of" Enums(reject, link)
+// @Param fuzzy query bool false "Искать дубликаты по похожим, а не только совпадающим ФИО"
+// @Param Cache-Control header string false "no-cache - не использовать сохраненные ответы публичных API"
+// @Param Idempotency-Key header string false "Ключ идемпотентности: повтор запроса с тем же ключом возвращает исходный ответ вместо создания нового пользователя"
 // @Success 200 {object} dto.ResponseDTO{payload=dto.UserCreatePayload}
+// @Header 200 {string} Idempotent-Replayed "true, если ответ повторен по Idempotency-Key"
 // @Failure 400 {object} dto.ErrorResponseDTO
+// @Failure 409 {object} dto.ErrorResponseDTO
+// @Failure 422 {object} dto.ErrorResponseDTO
 // @Failure 500 {object} dto.ErrorResponseDTO
 // @Router /users [post]
 func (uh *UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
@@ -156,29 +386,147 @@ func (uh *UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if ucDTO.Name == "" {
-		errorResponse(ctx, w, apperror.NewHttpError(400, "name is empty"))
+	check := model.DuplicateCheck{Policy: model.DuplicateReject}
+	if policy := r.FormValue("on_duplicate"); policy != "" {
+		if !model.IsValidDuplicatePolicy(policy) {
+			errorResponse(ctx, w, apperror.NewHttpError(400, "on_duplicate must be one of: reject, link"))
+			return
+		}
+		check.Policy = policy
+	}
+	if fuzzy := r.FormValue("fuzzy"); fuzzy != "" {
+		boolFuzzy, err := strconv.ParseBool(fuzzy)
+		if err != nil {
+			errorResponse(ctx, w, apperror.NewHttpError(400, "fuzzy must be a boolean"))
+			return
+		}
+		check.Fuzzy = boolFuzzy
+	}
+
+	if noCache(r) {
+		ctx = cache.WithBypass(ctx)
+	}
+
+	payload, err := uh.userService.CreateUser(ctx, ucDTO, check)
+	if err != nil {
+		errorResponse(ctx, w, err)
+		return
+	}
+
+	successResponse(ctx, w, 200, payload)
+}
+
+// CreateUsers godoc
+// @Summary Пакетное создание пользователей
+// @Description Создание списка пользователей одним запросом. Пользователи сохраняются одной транзакцией и ставятся в очередь обогащения, где имена дедуплицируются и обогащаются пакетными запросами к публичным API. Невалидные элементы не прерывают обработку и возвращаются с текстом ошибки. Точные дубликаты существующих пользователей и повторы ФИО внутри пакета по умолчанию не создаются и возвращаются с existing_uuid
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param users body []dto.UserCreateDTO true "Список пользователей"
+// @Param on_duplicate query string false "Поведение при найденном пользователе с тем же ФИО: reject (по умолчанию) - элемент не создается и возвращается с existing_uuid, link - создать со ссылкой duplicate_of" Enums(reject, link)
+// @Param Cache-Control header string false "no-cache - не использовать сохраненные ответы публичных API"
+// @Param Idempotency-Key header string false "Ключ идемпотентности: повтор запроса с тем же ключом возвращает исходный ответ вместо повторного создания"
+// @Success 200 {object} dto.ResponseDTO{payload=dto.UserBatchCreatePayload}
+// @Header 200 {string} Idempotent-Replayed "true, если ответ повторен по Idempotency-Key"
+// @Failure 400 {object} dto.ErrorResponseDTO
+// @Failure 409 {object} dto.ErrorResponseDTO
+// @Failure 422 {object} dto.ErrorResponseDTO
+// @Failure 500 {object} dto.ErrorResponseDTO
+// @Router /users/batch [post]
+func (uh *UserHandler) CreateUsers(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	ucDTOs := []dto.UserCreateDTO{}
+	err := json.NewDecoder(r.Body).Decode(&ucDTOs)
+	if err != nil {
+		errorResponse(ctx, w, apperror.NewHttpError(400, "invalid users json structure"))
+		return
+	}
+
+	if len(ucDTOs) == 0 {
+		errorResponse(ctx, w, apperror.NewHttpError(400, "users list is empty"))
+		return
+	}
+	if len(ucDTOs) > maxBatchSize {
+		errorResponse(ctx, w, apperror.NewHttpError(400, fmt.Sprintf("users list can't contain more than %d items", maxBatchSize)))
+		return
+	}
+
+	policy := r.FormValue("on_duplicate")
+	if policy == "" {
+		policy = model.DuplicateReject
+	}
+	if !model.IsValidDuplicatePolicy(policy) {
+		errorResponse(ctx, w, apperror.NewHttpError(400, "on_duplicate must be one of: reject, link"))
+		return
+	}
+
+	if noCache(r) {
+		ctx = cache.WithBypass(ctx)
+	}
+
+	result, err := uh.userService.CreateUsers(ctx, ucDTOs, policy)
+	if err != nil {
+		errorResponse(ctx, w, err)
+		return
+	}
+
+	successResponse(ctx, w, 200, result)
+}
+
+// ReplaceUser godoc
+// @Summary Замена данных пользователя
+// @Description Полная замена изменяемых данных пользователя: необязательные поля, отсутствующие в теле запроса, очищаются
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param uuid path string true "ID пользователя"
+// @Param user body dto.UserReplaceDTO true "Новые данные пользователя"
+// @Param If-Match header string false "ETag пользователя: замена применяется, только если пользователь не менялся с момента получения"
+// @Success 200 {object} dto.EmptyResponseDTO
+// @Header 200 {string} ETag "Новая версия пользователя"
+// @Failure 400 {object} dto.ErrorResponseDTO
+// @Failure 404 {object} dto.ErrorResponseDTO
+// @Failure 412 {object} dto.ErrorResponseDTO
+// @Failure 500 {object} dto.ErrorResponseDTO
+// @Router /users/{uuid} [put]
+func (uh *UserHandler) ReplaceUser(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	uuid := r.PathValue("uuid")
+	if uuid == "" {
+		errorResponse(ctx, w, apperror.NewHttpError(400, "uuid is empty"))
+		return
+	}
+
+	urDTO := &dto.UserReplaceDTO{}
+	err := json.NewDecoder(r.Body).Decode(urDTO)
+	if err != nil {
+		errorResponse(ctx, w, apperror.NewHttpError(400, "invalid user json structure"))
 		return
 	}
-	if ucDTO.Surname == "" {
-		errorResponse(ctx, w, apperror.NewHttpError(400, "surname is empty"))
+
+	version, err := ifMatch(r)
+	if err != nil {
+		errorResponse(ctx, w, err)
 		return
 	}
 
-	uuid, err := uh.userService.CreateUser(ctx, ucDTO)
+	newVersion, err := uh.userService.ReplaceUser(ctx, types.UUID(uuid), urDTO, version)
 	if err != nil {
 		errorResponse(ctx, w, err)
 		return
 	}
+	w.Header().Set("ETag", etag(newVersion))
 
-	successResponse(ctx, w, 200, &dto.UserCreatePayload{UUID: uuid})
+	successResponse(ctx, w, 200, nil)
 }
 
 // UpdateUser godoc
 // @Summary Обновление данных пользователя
-// @Description Обновление данных пользователя (в теле запроса нет обязательных полей, но в случае передачи пустого тела запроса будет возвращен ответ с кодом 400)
+// @Description Обновление данных пользователя в формате JSON Merge Patch (RFC 7396): отсутствующие поля не меняются, null очищает поле (кроме name и surname). В теле запроса нет обязательных полей, но в случае передачи пустого тела запроса будет возвращен ответ с кодом 400
 // @Tags users
-// @Accept json
+// @Accept json,application/merge-patch+json
 // @Produce json
 // @Param uuid path string true "ID пользователя"
 // @Param name body string false "Имя пользователя"
@@ -187,9 +535,12 @@ func (uh *UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
 // @Param age body int false "Возраст пользователя"
 // @Param gender body string false "Пол пользователя"
 // @Param country_id body string false "Код страны пользователя"
+// @Param If-Match header string false "ETag пользователя: изменение применяется, только если пользователь не менялся с момента получения"
 // @Success 200 {object} dto.EmptyResponseDTO
+// @Header 200 {string} ETag "Новая версия пользователя"
 // @Failure 400 {object} dto.ErrorResponseDTO
 // @Failure 404 {object} dto.ErrorResponseDTO
+// @Failure 412 {object} dto.ErrorResponseDTO
 // @Failure 500 {object} dto.ErrorResponseDTO
 // @Router /users/{uuid} [patch]
 func (uh *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
@@ -208,32 +559,39 @@ func (uh *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	hasUpdates := uuDTO.Name != nil || uuDTO.Surname != nil || uuDTO.Patronymic != nil ||
-		uuDTO.Age != nil || uuDTO.Gender != nil || uuDTO.CountryID != nil
-	if !hasUpdates {
+	if !uuDTO.HasUpdates() {
 		errorResponse(ctx, w, apperror.NewHttpError(400, "no payload provided for update"))
 		return
 	}
 
-	err = uh.userService.UpdateUser(ctx, types.UUID(uuid), uuDTO)
+	version, err := ifMatch(r)
+	if err != nil {
+		errorResponse(ctx, w, err)
+		return
+	}
+
+	newVersion, err := uh.userService.UpdateUser(ctx, types.UUID(uuid), uuDTO, version)
 	if err != nil {
 		errorResponse(ctx, w, err)
 		return
 	}
+	w.Header().Set("ETag", etag(newVersion))
 
 	successResponse(ctx, w, 200, nil)
 }
 
 // DeleteUser godoc
 // @Summary Удаление пользователя
-// @Description Удаление пользователя по переданному ID
+// @Description Удаление пользователя по переданному ID. Пользователь скрывается и может быть восстановлен до окончательного удаления по истечении срока хранения
 // @Tags users
 // @Accept json
 // @Produce json
 // @Param uuid path string true "ID пользователя"
+// @Param If-Match header string false "ETag пользователя: удаление выполняется, только если пользователь не менялся с момента получения"
 // @Success 200 {object} dto.EmptyResponseDTO
 // @Failure 400 {object} dto.ErrorResponseDTO
 // @Failure 404 {object} dto.ErrorResponseDTO
+// @Failure 412 {object} dto.ErrorResponseDTO
 // @Failure 500 {object} dto.ErrorResponseDTO
 // @Router /users/{uuid} [delete]
 func (uh *UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
@@ -245,7 +603,43 @@ func (uh *UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := uh.userService.DeleteUser(ctx, types.UUID(uuid))
+	version, err := ifMatch(r)
+	if err != nil {
+		errorResponse(ctx, w, err)
+		return
+	}
+
+	err = uh.userService.DeleteUser(ctx, types.UUID(uuid), version)
+	if err != nil {
+		errorResponse(ctx, w, err)
+		return
+	}
+
+	successResponse(ctx, w, 200, nil)
+}
+
+// RestoreUser godoc
+// @Summary Восстановление пользователя
+// @Description Восстановление удаленного пользователя, который еще не был удален окончательно
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param uuid path string true "ID пользователя"
+// @Success 200 {object} dto.EmptyResponseDTO
+// @Failure 400 {object} dto.ErrorResponseDTO
+// @Failure 404 {object} dto.ErrorResponseDTO
+// @Failure 500 {object} dto.ErrorResponseDTO
+// @Router /users/{uuid}/restore [post]
+func (uh *UserHandler) RestoreUser(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	uuid := r.PathValue("uuid")
+	if uuid == "" {
+		errorResponse(ctx, w, apperror.NewHttpError(400, "uuid is empty"))
+		return
+	}
+
+	err := uh.userService.RestoreUser(ctx, types.UUID(uuid))
 	if err != nil {
 		errorResponse(ctx, w, err)
 		return
@@ -253,3 +647,52 @@ func (uh *UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
 
 	successResponse(ctx, w, 200, nil)
 }
+
+// MergeUsers godoc
+// @Summary Слияние пользователей
+// @Description Слияние пользователя-дубликата source_uuid с пользователем из пути. Отчество, возраст, пол и страна переносятся по правилам prefer вместе с достоверностью и происхождением, по умолчанию - только незаполненные. Дубликат удаляется со ссылкой duplicate_of, история изменений обоих пользователей сохраняется
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param uuid path string true "ID пользователя, в которого выполняется слияние"
+// @Param merge body dto.UserMergeDTO true "Параметры слияния"
+// @Param If-Match header string false "ETag пользователя из пути: слияние выполняется, только если пользователь не менялся с момента получения"
+// @Success 200 {object} dto.ResponseDTO{payload=dto.UserPayload}
+// @Header 200 {string} ETag "Новая версия пользователя"
+// @Failure 400 {object} dto.ErrorResponseDTO
+// @Failure 404 {object} dto.ErrorResponseDTO
+// @Failure 409 {object} dto.ErrorResponseDTO
+// @Failure 412 {object} dto.ErrorResponseDTO
+// @Failure 500 {object} dto.ErrorResponseDTO
+// @Router /users/{uuid}/merge [post]
+func (uh *UserHandler) MergeUsers(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	uuid := r.PathValue("uuid")
+	if uuid == "" {
+		errorResponse(ctx, w, apperror.NewHttpError(400, "uuid is empty"))
+		return
+	}
+
+	umDTO := &dto.UserMergeDTO{}
+	err := json.NewDecoder(r.Body).Decode(umDTO)
+	if err != nil {
+		errorResponse(ctx, w, apperror.NewHttpError(400, "invalid merge json structure"))
+		return
+	}
+
+	version, err := ifMatch(r)
+	if err != nil {
+		errorResponse(ctx, w, err)
+		return
+	}
+
+	payload, err := uh.userService.MergeUsers(ctx, types.UUID(uuid), umDTO, version)
+	if err != nil {
+		errorResponse(ctx, w, err)
+		return
+	}
+	w.Header().Set("ETag", etag(payload.Version))
+
+	successResponse(ctx, w, 200, payload)
+}
@@ -0,0 +1,135 @@
+package httpclient
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+type (
+	// lookup ожидаемое предсказание по одному имени, done закрывается после ответа API
+	lookup[T PredictorResponse] struct {
+		done   chan struct{}
+		result T
+		err    error
+	}
+	// coalescer объединяет запросы к API: одинаковые имена, которые уже ждут ответа,
+	// не запрашиваются повторно, а разные имена, пришедшие в течение window,
+	// отправляются одним запросом name[] размером до size
+	coalescer[T PredictorResponse] struct {
+		mu       sync.Mutex
+		window   time.Duration
+		size     int
+		fetch    func(ctx context.Context, names []string) ([]T, error)
+		inflight map[string]*lookup[T]
+		pending  []string
+		// ctx контекст запросов к API. Пакет обслуживает разных вызывающих, поэтому запрос
+		// не отменяется вместе с одним из них и не наследует его значения, кроме логгера клиента
+		ctx        context.Context
+		timer      *time.Timer
+		generation uint64
+	}
+)
+
+func newCoalescer[T PredictorResponse](
+	window time.Duration,
+	size int,
+	logger zerolog.Logger,
+	fetch func(ctx context.Context, names []string) ([]T, error)) *coalescer[T] {
+	return &coalescer[T]{
+		window:   window,
+		size:     size,
+		fetch:    fetch,
+		inflight: make(map[string]*lookup[T]),
+		ctx:      logger.WithContext(context.Background()),
+	}
+}
+
+// Lookup возвращает предсказания в порядке names. Если ctx отменен раньше ответа,
+// запрос продолжается для других ожидающих
+func (c *coalescer[T]) Lookup(ctx context.Context, names []string) ([]T, error) {
+	lookups := make([]*lookup[T], len(names))
+
+	c.mu.Lock()
+	for i, name := range names {
+		l, ok := c.inflight[name]
+		if !ok {
+			l = &lookup[T]{done: make(chan struct{})}
+			c.inflight[name] = l
+			c.enqueue(name)
+		}
+		lookups[i] = l
+	}
+	switch {
+	case c.window <= 0:
+		c.flush()
+	case len(c.pending) > 0 && c.timer == nil:
+		generation := c.generation
+		c.timer = time.AfterFunc(c.window, func() {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			if c.generation == generation {
+				c.flush()
+			}
+		})
+	}
+	c.mu.Unlock()
+
+	results := make([]T, len(names))
+	for i, l := range lookups {
+		select {
+		case <-l.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if l.err != nil {
+			return nil, l.err
+		}
+		results[i] = l.result
+	}
+
+	return results, nil
+}
+
+func (c *coalescer[T]) enqueue(name string) {
+	c.pending = append(c.pending, name)
+	if len(c.pending) >= c.size {
+		c.flush()
+	}
+}
+
+// flush отправляет накопленный пакет. Вызывается под c.mu
+func (c *coalescer[T]) flush() {
+	if len(c.pending) == 0 {
+		return
+	}
+	names := c.pending
+	c.pending = nil
+	if c.timer != nil {
+		c.timer.Stop()
+		c.timer = nil
+	}
+	c.generation++
+
+	go c.run(names)
+}
+
+func (c *coalescer[T]) run(names []string) {
+	zerolog.Ctx(c.ctx).Debug().Str("method", "coalescer.run").Int("names", len(names)).Msg("sending coalesced request")
+	results, err := c.fetch(c.ctx, names)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, name := range names {
+		l := c.inflight[name]
+		delete(c.inflight, name)
+		if err != nil {
+			l.err = err
+		} else {
+			l.result = results[i]
+		}
+		close(l.done)
+	}
+}
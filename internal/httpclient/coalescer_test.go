@@ -0,0 +1,236 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// stubFetch запоминает пакеты, с которыми вызывался fetch. Если задан release,
+// ответ отдается только после его закрытия
+type stubFetch struct {
+	mu      sync.Mutex
+	calls   [][]string
+	at      []time.Time
+	ctxErrs []error
+	values  []interface{}
+	release chan struct{}
+	err     error
+}
+
+type ctxKey struct{}
+
+func (s *stubFetch) fetch(ctx context.Context, names []string) ([]AgifyResponse, error) {
+	s.mu.Lock()
+	s.calls = append(s.calls, slices.Clone(names))
+	s.at = append(s.at, time.Now())
+	s.mu.Unlock()
+
+	if s.release != nil {
+		<-s.release
+	}
+
+	s.mu.Lock()
+	s.ctxErrs = append(s.ctxErrs, ctx.Err())
+	s.values = append(s.values, ctx.Value(ctxKey{}))
+	s.mu.Unlock()
+
+	if s.err != nil {
+		return nil, s.err
+	}
+	results := make([]AgifyResponse, len(names))
+	for i, name := range names {
+		results[i] = AgifyResponse{Name: name, Count: 1}
+	}
+	return results, nil
+}
+
+func (s *stubFetch) snapshot() [][]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.calls)
+}
+
+// waitingContext отмечает в waiting, что Lookup зарегистрировал имена и ждет ответа
+type waitingContext struct {
+	context.Context
+	waiting *sync.WaitGroup
+	once    sync.Once
+}
+
+func (c *waitingContext) Done() <-chan struct{} {
+	c.once.Do(c.waiting.Done)
+	return c.Context.Done()
+}
+
+func newTestCoalescer(window time.Duration, size int, stub *stubFetch) *coalescer[AgifyResponse] {
+	return newCoalescer(window, size, zerolog.Nop(), stub.fetch)
+}
+
+func TestCoalescerDeduplicatesConcurrentIdenticalNames(t *testing.T) {
+	stub := &stubFetch{release: make(chan struct{})}
+	c := newTestCoalescer(5*time.Millisecond, 10, stub)
+
+	const callers = 50
+	waiting := &sync.WaitGroup{}
+	waiting.Add(callers)
+	errs := make(chan error, callers)
+	for range callers {
+		go func() {
+			ctx := &waitingContext{Context: context.Background(), waiting: waiting}
+			results, err := c.Lookup(ctx, []string{"anna"})
+			if err == nil && results[0].Name != "anna" {
+				err = fmt.Errorf("got prediction for %q, want anna", results[0].Name)
+			}
+			errs <- err
+		}()
+	}
+
+	waiting.Wait()
+	close(stub.release)
+	for range callers {
+		if err := <-errs; err != nil {
+			t.Fatalf("Lookup() error = %v", err)
+		}
+	}
+
+	calls := stub.snapshot()
+	if len(calls) != 1 {
+		t.Fatalf("fetch called %d times, want 1: %v", len(calls), calls)
+	}
+	if !slices.Equal(calls[0], []string{"anna"}) {
+		t.Fatalf("fetch names = %v, want [anna]", calls[0])
+	}
+}
+
+func TestCoalescerSplitsBySizeAndFlushesAfterWindow(t *testing.T) {
+	stub := &stubFetch{}
+	const window = 50 * time.Millisecond
+	c := newTestCoalescer(window, 3, stub)
+
+	names := []string{"anna", "boris", "clara", "denis", "elena", "fedor", "galina"}
+	start := time.Now()
+	results, err := c.Lookup(context.Background(), names)
+	if err != nil {
+		t.Fatalf("Lookup() error = %v", err)
+	}
+	for i, r := range results {
+		if r.Name != names[i] {
+			t.Fatalf("results[%d] = %q, want %q", i, r.Name, names[i])
+		}
+	}
+
+	stub.mu.Lock()
+	defer stub.mu.Unlock()
+	if len(stub.calls) != 3 {
+		t.Fatalf("fetch called %d times, want 3: %v", len(stub.calls), stub.calls)
+	}
+	for i, call := range stub.calls {
+		switch len(call) {
+		case 3:
+			if elapsed := stub.at[i].Sub(start); elapsed >= window {
+				t.Errorf("full batch %v sent after %v, want before window %v", call, elapsed, window)
+			}
+		case 1:
+			if !slices.Equal(call, []string{"galina"}) {
+				t.Errorf("partial batch = %v, want [galina]", call)
+			}
+			if elapsed := stub.at[i].Sub(start); elapsed < window {
+				t.Errorf("partial batch sent after %v, want at least window %v", elapsed, window)
+			}
+		default:
+			t.Errorf("batch %v has %d names, want 3 or 1", call, len(call))
+		}
+	}
+}
+
+func TestCoalescerCancelledCallerDoesNotFailOthers(t *testing.T) {
+	stub := &stubFetch{release: make(chan struct{})}
+	c := newTestCoalescer(5*time.Millisecond, 10, stub)
+
+	waiting := &sync.WaitGroup{}
+	waiting.Add(2)
+
+	cancelCtx, cancel := context.WithCancel(context.WithValue(context.Background(), ctxKey{}, "cancelled caller"))
+	cancelled := make(chan error, 1)
+	go func() {
+		_, err := c.Lookup(&waitingContext{Context: cancelCtx, waiting: waiting}, []string{"anna"})
+		cancelled <- err
+	}()
+
+	type lookupResult struct {
+		results []AgifyResponse
+		err     error
+	}
+	other := make(chan lookupResult, 1)
+	go func() {
+		results, err := c.Lookup(&waitingContext{Context: context.Background(), waiting: waiting}, []string{"anna"})
+		other <- lookupResult{results, err}
+	}()
+
+	waiting.Wait()
+	cancel()
+	if err := <-cancelled; !errors.Is(err, context.Canceled) {
+		t.Fatalf("cancelled Lookup() error = %v, want %v", err, context.Canceled)
+	}
+
+	close(stub.release)
+	res := <-other
+	if res.err != nil {
+		t.Fatalf("Lookup() error = %v", res.err)
+	}
+	if res.results[0].Name != "anna" {
+		t.Fatalf("got prediction for %q, want anna", res.results[0].Name)
+	}
+
+	stub.mu.Lock()
+	defer stub.mu.Unlock()
+	if len(stub.calls) != 1 {
+		t.Fatalf("fetch called %d times, want 1: %v", len(stub.calls), stub.calls)
+	}
+	if stub.ctxErrs[0] != nil {
+		t.Errorf("fetch context error = %v, want nil", stub.ctxErrs[0])
+	}
+	if stub.values[0] != nil {
+		t.Errorf("fetch context carries caller value %v", stub.values[0])
+	}
+}
+
+func TestCoalescerFanOutsFetchError(t *testing.T) {
+	errFetch := errors.New("API is unavailable")
+	stub := &stubFetch{release: make(chan struct{}), err: errFetch}
+	c := newTestCoalescer(5*time.Millisecond, 10, stub)
+
+	names := []string{"anna", "boris", "anna", "clara", "boris"}
+	waiting := &sync.WaitGroup{}
+	waiting.Add(len(names))
+	errs := make(chan error, len(names))
+	for _, name := range names {
+		go func() {
+			_, err := c.Lookup(&waitingContext{Context: context.Background(), waiting: waiting}, []string{name})
+			errs <- err
+		}()
+	}
+
+	waiting.Wait()
+	close(stub.release)
+	for range names {
+		if err := <-errs; !errors.Is(err, errFetch) {
+			t.Fatalf("Lookup() error = %v, want %v", err, errFetch)
+		}
+	}
+
+	total := 0
+	for _, call := range stub.snapshot() {
+		total += len(call)
+	}
+	if total != 3 {
+		t.Fatalf("fetch requested %d names, want 3 unique names", total)
+	}
+}
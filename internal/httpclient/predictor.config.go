@@ -6,13 +6,60 @@ import (
 	"time"
 )
 
-type PredictorClientConfig struct {
-	Name       APIType
-	Token      string
-	BaseURL    string
-	Timeout    time.Duration
-	HttpClient *http.Client
-}
+type (
+	PredictorClientConfig struct {
+		Name      APIType
+		Token     string
+		Auth      AuthConfig
+		BaseURL   string
+		Timeout   time.Duration
+		BatchSize int
+		// BatchWindow время, в течение которого разные имена из параллельных вызовов
+		// собираются в один запрос. Отрицательное значение отключает ожидание
+		BatchWindow time.Duration
+		Retry       RetryPolicy
+		Breaker     CircuitBreakerConfig
+		// QuotaReserve остаток квоты API, который клиент не расходует: при его достижении
+		// запросы не отправляются до конца окна квоты
+		QuotaReserve int
+		Threshold    ConfidenceThreshold
+		HttpClient   *http.Client
+	}
+	// RetryPolicy повтор запросов при сетевых ошибках, 429 и 5xx.
+	// Задержка растет экспоненциально от BaseDelay до MaxDelay со случайным разбросом,
+	// Retry-After больше MaxDelay не ожидается
+	RetryPolicy struct {
+		MaxAttempts int
+		BaseDelay   time.Duration
+		MaxDelay    time.Duration
+	}
+	CircuitBreakerConfig struct {
+		FailureThreshold int
+		OpenTimeout      time.Duration
+	}
+	// AuthConfig способ передачи ключа API. Name - название query параметра для AuthQuery
+	// или заголовка для AuthHeader, для AuthBearer не используется
+	AuthConfig struct {
+		Placement AuthPlacement
+		Name      string
+	}
+	AuthPlacement string
+	// ConfidenceThreshold минимальная достоверность предсказания. Значение ниже порога
+	// не записывается пользователю и отправляется на ручную проверку. Нулевые значения отключают проверку
+	ConfidenceThreshold struct {
+		MinProbability float64
+		MinCount       uint
+	}
+)
+
+const (
+	// AuthQuery ключ передается query параметром, по умолчанию apikey
+	AuthQuery AuthPlacement = "query"
+	// AuthBearer ключ передается заголовком Authorization: Bearer
+	AuthBearer AuthPlacement = "bearer"
+	// AuthHeader ключ передается заголовком с названием из AuthConfig.Name, по умолчанию X-API-Key
+	AuthHeader AuthPlacement = "header"
+)
 
 func (c *PredictorClientConfig) Validate() error {
 	if c.Name == "" {
@@ -24,11 +71,76 @@ func (c *PredictorClientConfig) Validate() error {
 	if c.BaseURL == "" {
 		return fmt.Errorf("base URL is required")
 	}
+	if err := c.Auth.Validate(); err != nil {
+		return err
+	}
 	if c.Timeout == 0 {
 		c.Timeout = 10 * time.Second
 	}
+	if c.BatchSize <= 0 {
+		c.BatchSize = 10
+	}
+	if c.BatchWindow == 0 {
+		c.BatchWindow = 10 * time.Millisecond
+	}
+	if c.Retry.MaxAttempts <= 0 {
+		c.Retry.MaxAttempts = 3
+	}
+	if c.Retry.BaseDelay <= 0 {
+		c.Retry.BaseDelay = 200 * time.Millisecond
+	}
+	if c.Retry.MaxDelay <= 0 {
+		c.Retry.MaxDelay = 5 * time.Second
+	}
+	if c.Retry.MaxDelay < c.Retry.BaseDelay {
+		return fmt.Errorf("retry max delay must be greater than base delay")
+	}
+	if c.Breaker.FailureThreshold <= 0 {
+		c.Breaker.FailureThreshold = 5
+	}
+	if c.Breaker.OpenTimeout <= 0 {
+		c.Breaker.OpenTimeout = 30 * time.Second
+	}
+	if c.QuotaReserve < 0 {
+		return fmt.Errorf("quota reserve must not be negative")
+	}
+	if c.Threshold.MinProbability < 0 || c.Threshold.MinProbability > 1 {
+		return fmt.Errorf("min probability must be between 0 and 1")
+	}
 	if c.HttpClient == nil {
 		c.HttpClient = &http.Client{Timeout: c.Timeout}
 	}
 	return nil
 }
+
+func (c *AuthConfig) Validate() error {
+	if c.Placement == "" {
+		c.Placement = AuthQuery
+	}
+	switch c.Placement {
+	case AuthQuery:
+		if c.Name == "" {
+			c.Name = "apikey"
+		}
+	case AuthHeader:
+		if c.Name == "" {
+			c.Name = "X-API-Key"
+		}
+	case AuthBearer:
+	default:
+		return fmt.Errorf("auth placement must be one of %s, %s, %s", AuthQuery, AuthBearer, AuthHeader)
+	}
+	return nil
+}
+
+// Check возвращает причину, по которой предсказание не проходит порог.
+// probability равен nil для API, которые не сообщают вероятность (agify)
+func (t ConfidenceThreshold) Check(probability *float64, count uint) error {
+	if probability != nil && *probability < t.MinProbability {
+		return fmt.Errorf("probability %.2f is below %.2f", *probability, t.MinProbability)
+	}
+	if count < t.MinCount {
+		return fmt.Errorf("sample count %d is below %d", count, t.MinCount)
+	}
+	return nil
+}
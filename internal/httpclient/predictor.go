@@ -3,10 +3,14 @@ package httpclient
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"math/rand/v2"
 	"net/http"
 	"net/url"
+	"strconv"
+	"time"
 
 	"effective-mobile-test-task/internal/apperror"
 
@@ -14,61 +18,264 @@ import (
 )
 
 type PredictorClient[T PredictorResponse] struct {
-	cfg PredictorClientConfig
+	cfg       PredictorClientConfig
+	breaker   *CircuitBreaker
+	quota     *QuotaTracker
+	coalescer *coalescer[T]
+	logger    zerolog.Logger
 }
 
-func NewPredictorClient[T PredictorResponse](cfg PredictorClientConfig) (*PredictorClient[T], error) {
+// NewPredictorClient создает клиент API. logger используется в запросах, объединенных
+// из нескольких вызовов, так как они не относятся к одному входящему запросу
+func NewPredictorClient[T PredictorResponse](cfg PredictorClientConfig, logger zerolog.Logger) (*PredictorClient[T], error) {
 	if err := cfg.Validate(); err != nil {
 		return nil, err
 	}
 
-	return &PredictorClient[T]{cfg: cfg}, nil
+	pc := &PredictorClient[T]{
+		cfg:     cfg,
+		breaker: NewCircuitBreaker(cfg.Breaker),
+		quota:   NewQuotaTracker(cfg.Name, cfg.QuotaReserve),
+		logger:  logger.With().Str("component", "predictor_client").Str("api", string(cfg.Name)).Logger(),
+	}
+	pc.coalescer = newCoalescer(cfg.BatchWindow, cfg.BatchSize, pc.logger, pc.fetch)
+	return pc, nil
 }
 
 func (pc *PredictorClient[T]) Predict(ctx context.Context, name string) (*T, error) {
-	methodName := fmt.Sprintf("%s.Predict", pc.cfg.Name)
+	results, err := pc.coalescer.Lookup(ctx, []string{name})
+	if err != nil {
+		return nil, err
+	}
+
+	return &results[0], nil
+}
+
+// PredictBatch запрашивает предсказания для нескольких имен, результат соответствует порядку names.
+// Имена, которые уже запрошены другими вызовами, не запрашиваются повторно, а остальные
+// объединяются с параллельными вызовами в запросы name[] по cfg.BatchSize
+func (pc *PredictorClient[T]) PredictBatch(ctx context.Context, names []string) ([]T, error) {
+	return pc.coalescer.Lookup(ctx, names)
+}
+
+// fetch запрашивает предсказания для пакета не больше cfg.BatchSize имен, используя параметр name[].
+// Одно имя запрашивается параметром name
+func (pc *PredictorClient[T]) fetch(ctx context.Context, names []string) ([]T, error) {
+	if len(names) == 1 {
+		methodName := fmt.Sprintf("%s.Predict", pc.cfg.Name)
+
+		var result T
+		if err := pc.get(ctx, methodName, url.Values{"name": {names[0]}}, &result); err != nil {
+			return nil, err
+		}
+		return []T{result}, nil
+	}
+
+	methodName := fmt.Sprintf("%s.PredictBatch", pc.cfg.Name)
+
 	params := url.Values{}
-	params.Add("name", name)
-	fullURL := fmt.Sprintf("%s?%s", pc.cfg.BaseURL, params.Encode())
+	for _, name := range names {
+		params.Add("name[]", name)
+	}
 
+	var results []T
+	if err := pc.get(ctx, methodName, params, &results); err != nil {
+		return nil, err
+	}
+	if len(results) != len(names) {
+		return nil, apperror.NewAppError(methodName, fmt.Sprintf("expected %d predictions, got %d", len(names), len(results)), nil)
+	}
+
+	return results, nil
+}
+
+func (pc *PredictorClient[T]) get(ctx context.Context, methodName string, params url.Values, result interface{}) error {
 	log := zerolog.Ctx(ctx).With().Str("method", methodName).Logger()
-	log.Debug().Str("utl", fullURL).Msg("building request URL")
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fullURL, nil)
+	// каждое имя пакетного запроса расходует квоту отдельно
+	cost := max(len(params["name[]"]), 1)
+
+	var lastErr error
+	for attempt := 1; attempt <= pc.cfg.Retry.MaxAttempts; attempt++ {
+		if err := pc.quota.Allow(cost); err != nil {
+			log.Warn().Err(err).Int("cost", cost).Msg("request rejected by quota reserve")
+			return apperror.NewAppError(methodName, "API quota is below reserve", err)
+		}
+		if err := pc.breaker.Allow(); err != nil {
+			log.Warn().Str("breaker", string(pc.breaker.State())).Msg("request rejected by circuit breaker")
+			return apperror.NewAppError(methodName, "API is unavailable", err)
+		}
+
+		body, retryAfter, err := pc.do(ctx, methodName, params)
+		if err == nil {
+			pc.breaker.Success()
+			if err := json.Unmarshal(body, result); err != nil {
+				return apperror.NewAppError(methodName, "response unmarshelling error", err)
+			}
+			return nil
+		}
+		lastErr = err
+
+		retryable, upstreamFailure := classifyError(ctx, err)
+		switch {
+		case upstreamFailure:
+			pc.breaker.Failure()
+		case ctx.Err() != nil:
+			pc.breaker.Release()
+		default:
+			pc.breaker.Success()
+		}
+		if !retryable || attempt == pc.cfg.Retry.MaxAttempts {
+			break
+		}
+
+		delay := pc.backoff(attempt)
+		if retryAfter > 0 {
+			if retryAfter > pc.cfg.Retry.MaxDelay {
+				log.Warn().Dur("retry_after", retryAfter).Msg("Retry-After exceeds max retry delay, giving up")
+				break
+			}
+			delay = retryAfter
+		}
+
+		log.Warn().Err(err).Int("attempt", attempt).Dur("delay", delay).Msg("request failed, retrying")
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return apperror.NewAppError(methodName, "request cancelled while waiting for retry", ctx.Err())
+		case <-timer.C:
+		}
+	}
+
+	return lastErr
+}
+
+func (pc *PredictorClient[T]) do(ctx context.Context, methodName string, params url.Values) ([]byte, time.Duration, error) {
+	log := zerolog.Ctx(ctx).With().Str("method", methodName).Logger()
+
+	// URL логируется до добавления ключа, чтобы ключ не попал в логи
+	safeURL := fmt.Sprintf("%s?%s", pc.cfg.BaseURL, params.Encode())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, safeURL, nil)
 	if err != nil {
-		return nil, apperror.NewAppError(methodName, "creating request error", err)
+		return nil, 0, apperror.NewAppError(methodName, "creating request error", err)
 	}
+	pc.authorize(req)
 
-	log.Debug().Str("url", req.URL.String()).Msg("sending request")
+	log.Debug().Str("url", safeURL).Msg("sending request")
 
 	resp, err := pc.cfg.HttpClient.Do(req)
 	if err != nil {
-		return nil, apperror.NewAppError(methodName, "request failed", err)
+		// ошибка транспорта содержит полный URL запроса вместе с ключом
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			urlErr.URL = safeURL
+		}
+		return nil, 0, apperror.NewAppError(methodName, "request failed", err)
 	}
 	defer resp.Body.Close()
 
 	log.Debug().Int("status_code", resp.StatusCode).Msg("received response")
 
+	retryAfter := parseRetryAfter(resp.Header.Get("Retry-After"))
+	if pc.quota.Update(resp.Header, resp.StatusCode, retryAfter) {
+		state := pc.quota.State()
+		log.Warn().
+			Interface("remaining", state.Remaining).
+			Int("reserve", state.Reserve).
+			Interface("reset_at", state.ResetAt).
+			Msg("API quota reached reserve, requests are throttled until reset")
+	} else if state := pc.quota.State(); state.Remaining != nil {
+		log.Debug().Int("remaining", *state.Remaining).Interface("limit", state.Limit).Msg("API quota updated")
+	}
+
 	const maxResponseSize = 1 << 20
 	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
 	if err != nil {
-		return nil, apperror.NewAppError(methodName, "response body reading error", err)
+		return nil, 0, apperror.NewAppError(methodName, "response body reading error", err)
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, &HttpError{
+		return nil, retryAfter, &HttpError{
 			Method:     methodName,
 			StatusCode: resp.StatusCode,
 			Body:       string(body),
 		}
 	}
 
-	var result T
-	if err := json.Unmarshal(body, &result); err != nil {
-		return nil, apperror.NewAppError(methodName, "response unmarshelling error", err)
+	return body, 0, nil
+}
+
+// authorize добавляет ключ API в запрос согласно cfg.Auth
+func (pc *PredictorClient[T]) authorize(req *http.Request) {
+	switch pc.cfg.Auth.Placement {
+	case AuthQuery:
+		query := req.URL.Query()
+		query.Set(pc.cfg.Auth.Name, pc.cfg.Token)
+		req.URL.RawQuery = query.Encode()
+	case AuthBearer:
+		req.Header.Set("Authorization", "Bearer "+pc.cfg.Token)
+	case AuthHeader:
+		req.Header.Set(pc.cfg.Auth.Name, pc.cfg.Token)
+	}
+}
+
+// backoff экспоненциальная задержка с полным разбросом (full jitter)
+func (pc *PredictorClient[T]) backoff(attempt int) time.Duration {
+	delay := pc.cfg.Retry.BaseDelay << (attempt - 1)
+	if delay <= 0 || delay > pc.cfg.Retry.MaxDelay {
+		delay = pc.cfg.Retry.MaxDelay
+	}
+	return time.Duration(rand.Int64N(int64(delay) + 1))
+}
+
+func (pc *PredictorClient[T]) Name() APIType {
+	return pc.cfg.Name
+}
+
+func (pc *PredictorClient[T]) BreakerState() BreakerState {
+	return pc.breaker.State()
+}
+
+func (pc *PredictorClient[T]) Quota() QuotaState {
+	return pc.quota.State()
+}
+
+// classifyError определяет, стоит ли повторять запрос и говорит ли ошибка о недоступности API
+func classifyError(ctx context.Context, err error) (retryable bool, upstreamFailure bool) {
+	if ctx.Err() != nil {
+		return false, false
+	}
+
+	var httpErr *HttpError
+	if errors.As(err, &httpErr) {
+		switch {
+		case httpErr.StatusCode == http.StatusTooManyRequests:
+			return true, false
+		case httpErr.StatusCode >= 500:
+			return true, true
+		}
+		return false, false
+	}
+
+	var appErr *apperror.AppError
+	if errors.As(err, &appErr) && appErr.Err != nil {
+		return true, true
 	}
+	return false, false
+}
 
-	return &result, nil
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return time.Until(t)
+	}
+	return 0
 }
 
 func (pc *PredictorClient[T]) WithHTTPClient(client *http.Client) *PredictorClient[T] {
@@ -79,5 +286,7 @@ func (pc *PredictorClient[T]) WithHTTPClient(client *http.Client) *PredictorClie
 	newCfg := pc.cfg
 	newCfg.HttpClient = client
 
-	return &PredictorClient[T]{cfg: newCfg}
+	newPC := &PredictorClient[T]{cfg: newCfg, breaker: pc.breaker, quota: pc.quota, logger: pc.logger}
+	newPC.coalescer = newCoalescer(newCfg.BatchWindow, newCfg.BatchSize, newPC.logger, newPC.fetch)
+	return newPC
 }
@@ -0,0 +1,139 @@
+package httpclient
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var ErrQuotaReserve = errors.New("API quota is below reserve")
+
+type (
+	// QuotaError запрос не отправлен, потому что остаток квоты API опустился до резерва.
+	// Квота восстановится в ResetAt
+	QuotaError struct {
+		API     APIType
+		ResetAt time.Time
+	}
+	// QuotaState последнее известное состояние квоты API. Пустые Limit и Remaining -
+	// API еще не сообщал квоту или окно квоты уже сменилось
+	QuotaState struct {
+		Limit     *int
+		Remaining *int
+		Reserve   int
+		ResetAt   *time.Time
+		UpdatedAt *time.Time
+		Throttled bool
+	}
+	// QuotaTracker отслеживает квоту API по заголовкам X-Rate-Limit-* и перестает
+	// пропускать запросы, которые израсходуют резерв, до конца окна квоты
+	QuotaTracker struct {
+		mu        sync.Mutex
+		api       APIType
+		reserve   int
+		known     bool
+		limit     int
+		remaining int
+		resetAt   time.Time
+		updatedAt time.Time
+		// alerted о достижении резерва в текущем окне квоты уже сообщено
+		alerted bool
+	}
+)
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("%s: %v until %s", e.API, ErrQuotaReserve, e.ResetAt.Format(time.RFC3339))
+}
+
+func (e *QuotaError) Is(target error) bool {
+	return target == ErrQuotaReserve
+}
+
+func NewQuotaTracker(api APIType, reserve int) *QuotaTracker {
+	return &QuotaTracker{api: api, reserve: reserve}
+}
+
+// Allow резервирует cost запросов квоты. Пока квота неизвестна или окно сменилось, запросы пропускаются
+func (qt *QuotaTracker) Allow(cost int) error {
+	qt.mu.Lock()
+	defer qt.mu.Unlock()
+
+	if !qt.active() {
+		return nil
+	}
+	if qt.remaining-cost < qt.reserve {
+		return &QuotaError{API: qt.api, ResetAt: qt.resetAt}
+	}
+	qt.remaining -= cost
+	return nil
+}
+
+// Update обновляет квоту по заголовкам ответа. 429 без заголовков означает, что квота
+// исчерпана до окончания Retry-After. Возвращает true, когда остаток впервые за окно опустился до резерва
+func (qt *QuotaTracker) Update(header http.Header, statusCode int, retryAfter time.Duration) bool {
+	limit, limitErr := strconv.Atoi(header.Get("X-Rate-Limit-Limit"))
+	remaining, remainingErr := strconv.Atoi(header.Get("X-Rate-Limit-Remaining"))
+	reset, resetErr := strconv.Atoi(header.Get("X-Rate-Limit-Reset"))
+
+	qt.mu.Lock()
+	defer qt.mu.Unlock()
+
+	now := time.Now()
+	switch {
+	case remainingErr == nil && resetErr == nil:
+		qt.remaining = remaining
+		qt.resetAt = now.Add(time.Duration(reset) * time.Second)
+		if limitErr == nil {
+			qt.limit = limit
+		}
+	case statusCode == http.StatusTooManyRequests && retryAfter > 0:
+		qt.remaining = 0
+		qt.resetAt = now.Add(retryAfter)
+	default:
+		return false
+	}
+	qt.known = true
+	qt.updatedAt = now
+
+	if !qt.throttled() {
+		qt.alerted = false
+		return false
+	}
+	alert := !qt.alerted
+	qt.alerted = true
+	return alert
+}
+
+func (qt *QuotaTracker) State() QuotaState {
+	qt.mu.Lock()
+	defer qt.mu.Unlock()
+
+	state := QuotaState{Reserve: qt.reserve}
+	if !qt.known {
+		return state
+	}
+	updatedAt := qt.updatedAt
+	state.UpdatedAt = &updatedAt
+	if qt.active() {
+		limit, remaining, resetAt := qt.limit, qt.remaining, qt.resetAt
+		if limit > 0 {
+			state.Limit = &limit
+		}
+		state.Remaining = &remaining
+		state.ResetAt = &resetAt
+		state.Throttled = qt.throttled()
+	}
+	return state
+}
+
+// active квота известна и ее окно еще не закончилось
+func (qt *QuotaTracker) active() bool {
+	return qt.known && time.Now().Before(qt.resetAt)
+}
+
+func (qt *QuotaTracker) throttled() bool {
+	return qt.active() && qt.remaining <= qt.reserve
+}
@@ -1,5 +1,7 @@
 package httpclient
 
+import "context"
+
 type (
 	APIType   string
 	HTTPError struct {
@@ -28,6 +30,12 @@ type (
 	}
 	PredictorResponse interface {
 		AgifyResponse | GenderizeResponse | NationalizeResponse
+		// Known сообщает, есть ли у API данные по имени
+		Known() bool
+	}
+	Predictor[T PredictorResponse] interface {
+		Predict(ctx context.Context, name string) (*T, error)
+		PredictBatch(ctx context.Context, names []string) ([]T, error)
 	}
 )
 
@@ -36,3 +44,15 @@ const (
 	Genderize   APIType = "genderize"
 	Nationalize APIType = "nationalize"
 )
+
+func (r AgifyResponse) Known() bool {
+	return r.Count > 0
+}
+
+func (r GenderizeResponse) Known() bool {
+	return r.Gender != ""
+}
+
+func (r NationalizeResponse) Known() bool {
+	return len(r.Countries) > 0
+}
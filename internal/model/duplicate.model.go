@@ -0,0 +1,61 @@
+package model
+
+import "effective-mobile-test-task/internal/types"
+
+type (
+	// DuplicateCheck параметры проверки дубликатов при создании пользователя
+	DuplicateCheck struct {
+		// Policy поведение при найденном дубликате: DuplicateReject или DuplicateLink
+		Policy string
+		// Fuzzy искать похожие ФИО по триграммам, а не только точные совпадения
+		Fuzzy bool
+	}
+	// UserMerge слияние пользователя Source в Target. Source удаляется и ссылается на Target
+	UserMerge struct {
+		TargetUUID types.UUID
+		SourceUUID types.UUID
+		// Fields поля, значения которых переносятся из Source вместе с достоверностью и происхождением
+		Fields []string
+		// TargetVersion и SourceVersion версии, по которым было принято решение о слиянии.
+		// Если пользователи изменились, слияние не выполняется
+		TargetVersion types.Version
+		SourceVersion types.Version
+	}
+)
+
+const (
+	// DuplicateReject при найденном дубликате пользователь не создается
+	DuplicateReject = "reject"
+	// DuplicateLink пользователь создается со ссылкой на найденный дубликат
+	DuplicateLink = "link"
+
+	MergeTarget = "target"
+	MergeSource = "source"
+)
+
+// HasValue сообщает, заполнено ли у пользователя поле из MergeableFields
+func (u *User) HasValue(field string) bool {
+	switch field {
+	case Patronymic:
+		return u.Patronymic != nil
+	case Age:
+		return u.Age != nil
+	case Gender:
+		return u.Gender != nil
+	case CountryId:
+		return u.CountryID != nil
+	}
+	return false
+}
+
+func IsValidDuplicatePolicy(policy string) bool {
+	switch policy {
+	case DuplicateReject, DuplicateLink:
+		return true
+	}
+	return false
+}
+
+// MergeableFields поля, которые можно перенести при слиянии. Имя и фамилия
+// определяют дубликат и остаются от основного пользователя
+var MergeableFields = []string{Patronymic, Age, Gender, CountryId}
@@ -0,0 +1,89 @@
+package model
+
+import "effective-mobile-test-task/internal/types"
+
+type (
+	// EnrichmentJob задача фонового обогащения пользователя данными публичных API
+	EnrichmentJob struct {
+		ID          int64
+		UserUUID    types.UUID
+		Name        types.Name
+		Attempts    int
+		BypassCache bool
+	}
+	// UserEnrichment предсказанные значения, nil - API не вернул данные
+	UserEnrichment struct {
+		Age       *types.Age
+		Gender    *types.Gender
+		CountryID *types.CountryID
+		Confidence
+		// Review причины, по которым предсказания не прошли порог достоверности,
+		// по названию поля. Такие поля остаются NULL до ручной проверки
+		Review map[string]string
+		// Provenance происхождение принятых предсказаний
+		Provenance Provenance
+	}
+	CountryProbability struct {
+		CountryID   types.CountryID
+		Probability types.Probability
+	}
+)
+
+const (
+	EnrichmentPending    = "pending"
+	EnrichmentDone       = "done"
+	EnrichmentIncomplete = "incomplete"
+	EnrichmentFailed     = "failed"
+	// EnrichmentNeedsReview часть предсказаний отброшена порогом достоверности
+	EnrichmentNeedsReview = "needs_review"
+)
+
+// EnrichableFields поля пользователя, которые могут заполнять источники обогащения
+var EnrichableFields = []string{Age, Gender, CountryId}
+
+// HasValue сообщает, есть ли в обогащении значение поля из EnrichableFields
+func (e *UserEnrichment) HasValue(field string) bool {
+	switch field {
+	case Age:
+		return e.Age != nil
+	case Gender:
+		return e.Gender != nil
+	case CountryId:
+		return e.CountryID != nil
+	}
+	return false
+}
+
+// Merge дополняет обогащение полями fields из from. Значение берется у первого источника,
+// который его дал, вместе с достоверностью и происхождением. Если значения нет ни у кого,
+// сохраняется первая причина проверки
+func (e *UserEnrichment) Merge(from *UserEnrichment, fields []string) {
+	for _, field := range fields {
+		if e.HasValue(field) {
+			continue
+		}
+		if from.HasValue(field) {
+			e.copyField(from, field)
+			e.Provenance[field] = from.Provenance[field]
+			delete(e.Review, field)
+			continue
+		}
+		if reason, ok := from.Review[field]; ok {
+			if _, reviewed := e.Review[field]; !reviewed {
+				e.copyField(from, field)
+				e.Review[field] = reason
+			}
+		}
+	}
+}
+
+func (e *UserEnrichment) copyField(from *UserEnrichment, field string) {
+	switch field {
+	case Age:
+		e.Age, e.AgeCount = from.Age, from.AgeCount
+	case Gender:
+		e.Gender, e.GenderProbability, e.GenderCount = from.Gender, from.GenderProbability, from.GenderCount
+	case CountryId:
+		e.CountryID, e.CountryProbability, e.CountryCount, e.Countries = from.CountryID, from.CountryProbability, from.CountryCount, from.Countries
+	}
+}
@@ -0,0 +1,22 @@
+package model
+
+import "time"
+
+// IdempotencyRecord запрос с заголовком Idempotency-Key и его сохраненный ответ
+type IdempotencyRecord struct {
+	// Scope метод и маршрут запроса, ключи разных маршрутов не пересекаются
+	Scope string
+	Key   string
+	// RequestHash хэш параметров и тела запроса, повтор с другим запросом отклоняется
+	RequestHash string
+	// StatusCode и Response пусты, пока первый запрос выполняется
+	StatusCode *int
+	Response   []byte
+	// TTL время, на которое занимается ключ
+	TTL time.Duration
+}
+
+// InProgress сообщает, что запрос с этим ключом еще выполняется
+func (r *IdempotencyRecord) InProgress() bool {
+	return r.StatusCode == nil
+}
@@ -0,0 +1,15 @@
+package model
+
+import "effective-mobile-test-task/internal/types"
+
+// NameStats статистика по имени для офлайн-предсказаний: средний возраст,
+// распределения полов и стран и размеры выборок, по которым они получены
+type NameStats struct {
+	Name         string
+	MeanAge      *float64
+	AgeCount     uint
+	Genders      map[types.Gender]float64
+	GenderCount  uint
+	Countries    map[types.CountryID]float64
+	CountryCount uint
+}
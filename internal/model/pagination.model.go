@@ -2,12 +2,35 @@ package model
 
 import (
 	"effective-mobile-test-task/internal/types"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
 )
 
-type Pagination struct {
-	Limit types.Limit
-	Page  types.Page
-}
+type (
+	Pagination struct {
+		Limit types.Limit
+		Page  types.Page
+		// Keyset включает постраничный вывод по курсору вместо OFFSET,
+		// After - позиция, после которой начинается страница (nil для первой страницы)
+		Keyset    bool
+		After     *Cursor
+		WithTotal bool
+	}
+	// Cursor позиция в отсортированном списке: значение поля сортировки и uuid
+	// последней записи предыдущей страницы
+	Cursor struct {
+		OrderBy  string     `json:"o"`
+		OrderDir string     `json:"d"`
+		Value    *string    `json:"v"`
+		UUID     types.UUID `json:"u"`
+	}
+	UserPage struct {
+		Users      []User
+		Total      *int
+		NextCursor *types.Cursor
+	}
+)
 
 func (p Pagination) GetLimit() uint64 {
 	if p.Limit == 0 {
@@ -22,3 +45,21 @@ func (p Pagination) GetPage() uint64 {
 	}
 	return uint64(p.Page)
 }
+
+func (c *Cursor) Encode() types.Cursor {
+	raw, _ := json.Marshal(c)
+	return types.Cursor(base64.RawURLEncoding.EncodeToString(raw))
+}
+
+func DecodeCursor(cursor types.Cursor) (*Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(string(cursor))
+	if err != nil {
+		return nil, fmt.Errorf("cursor is malformed")
+	}
+
+	c := &Cursor{}
+	if err := json.Unmarshal(raw, c); err != nil || c.UUID == "" {
+		return nil, fmt.Errorf("cursor is malformed")
+	}
+	return c, nil
+}
@@ -0,0 +1,14 @@
+package model
+
+import "time"
+
+// PredictionCacheEntry сохраненный ответ внешнего API для имени.
+// Known=false означает, что API не знает имя (негативный кэш)
+type PredictionCacheEntry struct {
+	API      string
+	Name     string
+	Response []byte
+	Known    bool
+	// TTL оставшееся время жизни записи
+	TTL time.Duration
+}
@@ -0,0 +1,58 @@
+package model
+
+import "time"
+
+type (
+	// FieldProvenance происхождение значения поля пользователя
+	FieldProvenance struct {
+		Kind   string    `json:"kind"`
+		Source string    `json:"source"`
+		SetAt  time.Time `json:"set_at"`
+	}
+	// Provenance происхождение значений по названию поля (age, gender, country_id).
+	// Отсутствие записи означает, что происхождение неизвестно
+	Provenance map[string]FieldProvenance
+)
+
+const (
+	ProvenancePredicted = "predicted"
+	ProvenanceManual    = "manual"
+	ProvenanceImported  = "imported"
+
+	// ProvenanceSourceAPI значение задано через REST API сервиса
+	ProvenanceSourceAPI = "api"
+	// ProvenanceSourceImport значение передано при создании пользователя
+	ProvenanceSourceImport = "import"
+)
+
+// IsLocked сообщает, что значение поля задано человеком и не перезаписывается обогащением
+func (p Provenance) IsLocked(field string) bool {
+	switch p[field].Kind {
+	case ProvenanceManual, ProvenanceImported:
+		return true
+	}
+	return false
+}
+
+// ExcludeLocked убирает из обогащения предсказания для полей, заданных вручную
+// или импортированных, и возвращает список таких полей
+func (e *UserEnrichment) ExcludeLocked(p Provenance) []string {
+	excluded := []string{}
+	if p.IsLocked(Age) {
+		e.Age, e.AgeCount = nil, nil
+		excluded = append(excluded, Age)
+	}
+	if p.IsLocked(Gender) {
+		e.Gender, e.GenderProbability, e.GenderCount = nil, nil, nil
+		excluded = append(excluded, Gender)
+	}
+	if p.IsLocked(CountryId) {
+		e.CountryID, e.CountryProbability, e.CountryCount, e.Countries = nil, nil, nil, nil
+		excluded = append(excluded, CountryId)
+	}
+	for _, field := range excluded {
+		delete(e.Review, field)
+		delete(e.Provenance, field)
+	}
+	return excluded
+}
@@ -0,0 +1,18 @@
+package model
+
+import (
+	"effective-mobile-test-task/internal/types"
+	"time"
+)
+
+// UserChange запись истории изменений пользователя. Для INSERT заполнен только New,
+// для DELETE - только Old, для UPDATE - изменившиеся колонки в обоих
+type UserChange struct {
+	ID        int64
+	UserUUID  types.UUID
+	Operation string
+	Old       map[string]interface{}
+	New       map[string]interface{}
+	RequestID *string
+	ChangedAt time.Time
+}
@@ -2,6 +2,8 @@ package model
 
 import (
 	"effective-mobile-test-task/internal/types"
+	"fmt"
+	"strconv"
 	"time"
 )
 
@@ -11,36 +13,95 @@ type (
 		Name       types.Name
 		Surname    types.Surname
 		Patronymic *types.Patronymic
-		Age        *types.Age
-		Gender     *types.Gender
-		CountryID  *types.CountryID
+		LatinNames
+		Age       *types.Age
+		Gender    *types.Gender
+		CountryID *types.CountryID
+		// Provenance происхождение переданных при создании age, gender и country_id
+		Provenance Provenance
+		// DuplicateOf найденный при создании дубликат, с которым связан пользователь
+		DuplicateOf *types.UUID
+		// BypassCache обогащение выполняется без кэша предсказаний
+		BypassCache bool
 	}
+	// UserUpdate изменение пользователя: nil и незаданные Nullable не меняются,
+	// Nullable с nil-значением очищает поле
 	UserUpdate struct {
 		Name       *types.Name
 		Surname    *types.Surname
-		Patronymic *types.Patronymic
-		Age        *types.Age
-		Gender     *types.Gender
-		CountryID  *types.CountryID
+		Patronymic types.Nullable[types.Patronymic]
+		// NameLatin, SurnameLatin и PatronymicLatin меняются вместе с исходными полями
+		NameLatin       *types.Name
+		SurnameLatin    *types.Surname
+		PatronymicLatin types.Nullable[types.Patronymic]
+		Age             types.Nullable[types.Age]
+		Gender          types.Nullable[types.Gender]
+		CountryID       types.Nullable[types.CountryID]
+		// Provenance происхождение изменяемых age, gender и country_id
+		Provenance Provenance
+		// IfVersions обновление применяется, только если текущая версия входит в список.
+		// nil - без проверки
+		IfVersions []types.Version
 	}
 	User struct {
 		UUID       types.UUID
 		Name       types.Name
 		Surname    types.Surname
 		Patronymic *types.Patronymic
-		Age        *types.Age
-		Gender     *types.Gender
-		CountryID  *types.CountryID
-		CreatedAt  time.Time
-		UpdatedAt  time.Time
+		LatinNames
+		Age              *types.Age
+		Gender           *types.Gender
+		CountryID        *types.CountryID
+		EnrichmentStatus types.EnrichmentStatus
+		Confidence
+		// ReviewReasons поля, требующие ручной проверки, и причины
+		ReviewReasons map[string]string
+		Provenance    Provenance
+		// DuplicateOf пользователь, дубликатом которого является этот, в том числе после слияния
+		DuplicateOf *types.UUID
+		// DeletedAt время мягкого удаления, nil - пользователь не удален
+		DeletedAt *time.Time
+		Version   types.Version
+		CreatedAt time.Time
+		UpdatedAt time.Time
+	}
+	// LatinNames ФИО в латинской транслитерации (ICAO), по ним запрашиваются
+	// предсказания и ведется поиск. Для латинских имен совпадают с исходными
+	LatinNames struct {
+		NameLatin       types.Name
+		SurnameLatin    types.Surname
+		PatronymicLatin *types.Patronymic
+	}
+	// Confidence достоверность предсказанных значений: вероятность и размер выборки API
+	Confidence struct {
+		AgeCount           *types.SampleCount
+		GenderProbability  *types.Probability
+		GenderCount        *types.SampleCount
+		CountryProbability *types.Probability
+		CountryCount       *types.SampleCount
+		// Countries полный список стран в порядке убывания вероятности
+		Countries []CountryProbability
 	}
 	UserFilter struct {
-		Name       *types.Name
-		Surname    *types.Surname
-		Patronymic *types.Patronymic
-		Age        *types.Age
-		Gender     *types.Gender
-		CountryID  *types.CountryID
+		Name                  *types.Name
+		Surname               *types.Surname
+		Patronymic            *types.Patronymic
+		Age                   *types.Age
+		AgeMin                *types.Age
+		AgeMax                *types.Age
+		Genders               []types.Gender
+		CountryIDs            []types.CountryID
+		CreatedFrom           *time.Time
+		CreatedTo             *time.Time
+		UpdatedFrom           *time.Time
+		UpdatedTo             *time.Time
+		Query                 *types.SearchQuery
+		EnrichmentStatuses    []types.EnrichmentStatus
+		MinAgeCount           *types.SampleCount
+		MinGenderProbability  *types.Probability
+		MinCountryProbability *types.Probability
+		// IncludeDeleted включать в выборку мягко удаленных пользователей
+		IncludeDeleted bool
 	}
 	UserQueryOptions struct {
 		Filter   UserFilter
@@ -63,6 +124,74 @@ const (
 	DESC       = "DESC"
 )
 
+func (f *UserFilter) Validate() error {
+	if f.AgeMin != nil && f.AgeMax != nil && *f.AgeMin > *f.AgeMax {
+		return fmt.Errorf("age_min must be less than or equal to age_max")
+	}
+	if f.CreatedFrom != nil && f.CreatedTo != nil && f.CreatedFrom.After(*f.CreatedTo) {
+		return fmt.Errorf("created_from must be before created_to")
+	}
+	if f.UpdatedFrom != nil && f.UpdatedTo != nil && f.UpdatedFrom.After(*f.UpdatedTo) {
+		return fmt.Errorf("updated_from must be before updated_to")
+	}
+	if f.MinGenderProbability != nil && (*f.MinGenderProbability < 0 || *f.MinGenderProbability > 1) {
+		return fmt.Errorf("min_gender_probability must be between 0 and 1")
+	}
+	if f.MinCountryProbability != nil && (*f.MinCountryProbability < 0 || *f.MinCountryProbability > 1) {
+		return fmt.Errorf("min_country_probability must be between 0 and 1")
+	}
+	return nil
+}
+
+// OrderValue возвращает значение поля сортировки в текстовом виде для курсора,
+// nil соответствует NULL в БД
+func (u *User) OrderValue(field string) *string {
+	var value string
+
+	switch field {
+	case UUID:
+		value = string(u.UUID)
+	case Name:
+		value = string(u.Name)
+	case Surname:
+		value = string(u.Surname)
+	case Patronymic:
+		if u.Patronymic == nil {
+			return nil
+		}
+		value = string(*u.Patronymic)
+	case Age:
+		if u.Age == nil {
+			return nil
+		}
+		value = strconv.FormatUint(uint64(*u.Age), 10)
+	case Gender:
+		if u.Gender == nil {
+			return nil
+		}
+		value = string(*u.Gender)
+	case CountryId:
+		if u.CountryID == nil {
+			return nil
+		}
+		value = string(*u.CountryID)
+	case CreatedAt:
+		value = u.CreatedAt.Format("2006-01-02 15:04:05.999999")
+	default:
+		return nil
+	}
+
+	return &value
+}
+
+func IsValidEnrichmentStatus(status string) bool {
+	switch status {
+	case EnrichmentPending, EnrichmentDone, EnrichmentIncomplete, EnrichmentFailed, EnrichmentNeedsReview:
+		return true
+	}
+	return false
+}
+
 func (uqo *UserQueryOptions) IsValidOrderBy(field string) bool {
 	switch field {
 	case UUID, Name, Surname, Patronymic, Age, Gender, CountryId, CreatedAt:
@@ -92,3 +221,19 @@ func (uqo *UserQueryOptions) GetOrderDir() string {
 	}
 	return string(*uqo.OrderDir)
 }
+
+// IsRelevanceOrder сортировка по релевантности поиска используется, когда передан
+// поисковый запрос без явного order_by; для курсорной пагинации она недоступна
+func (uqo *UserQueryOptions) IsRelevanceOrder() bool {
+	return uqo.Filter.Query != nil && uqo.OrderBy == nil && !uqo.Keyset
+}
+
+func (uqo *UserQueryOptions) ValidateCursor() error {
+	if uqo.After == nil {
+		return nil
+	}
+	if uqo.After.OrderBy != uqo.GetOrderBy() || uqo.After.OrderDir != uqo.GetOrderDir() {
+		return fmt.Errorf("cursor does not match order_by and order_dir")
+	}
+	return nil
+}
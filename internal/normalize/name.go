@@ -0,0 +1,32 @@
+package normalize
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Name приводит имя к единому виду: Unicode NFC, без пробелов по краям и заглавная первая
+// буква каждой части. Части двойного имени, разделенные пробелами и/или дефисами, соединяются
+// одним дефисом, так как допустимым разделителем в имени является только дефис (см. validation.Name),
+// например "  дмитрий " -> "Дмитрий", "анна  мария" и "анна - мария" -> "Анна-Мария"
+func Name(s string) string {
+	parts := strings.FieldsFunc(norm.NFC.String(s), func(r rune) bool {
+		return unicode.IsSpace(r) || r == '-'
+	})
+	s = strings.Join(parts, "-")
+
+	var b strings.Builder
+	b.Grow(len(s))
+	start := true
+	for _, r := range s {
+		if start {
+			b.WriteRune(unicode.ToUpper(r))
+		} else {
+			b.WriteRune(unicode.ToLower(r))
+		}
+		start = r == '-'
+	}
+	return b.String()
+}
@@ -0,0 +1,39 @@
+package normalize
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// icao транслитерация кириллицы по ICAO Doc 9303 (ГОСТ Р 52535.1-2006),
+// которая используется в загранпаспортах РФ
+var icao = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "e", 'ж': "zh",
+	'з': "z", 'и': "i", 'й': "i", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o",
+	'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u", 'ф': "f", 'х': "kh", 'ц': "ts",
+	'ч': "ch", 'ш': "sh", 'щ': "shch", 'ъ': "ie", 'ы': "y", 'ь': "", 'э': "e", 'ю': "iu",
+	'я': "ia",
+}
+
+// Transliterate переводит кириллицу в латиницу по ICAO, остальные символы не меняются.
+// Заглавная буква дает заглавную первую букву сочетания: "Щукин" -> "Shchukin"
+func Transliterate(s string) string {
+	var b strings.Builder
+	b.Grow(len(s) * 2)
+	for _, r := range s {
+		latin, ok := icao[unicode.ToLower(r)]
+		if !ok {
+			b.WriteRune(r)
+			continue
+		}
+		if unicode.IsUpper(r) && latin != "" {
+			first, size := utf8.DecodeRuneInString(latin)
+			b.WriteRune(unicode.ToUpper(first))
+			b.WriteString(latin[size:])
+			continue
+		}
+		b.WriteString(latin)
+	}
+	return b.String()
+}
@@ -0,0 +1,16 @@
+package repository
+
+import (
+	"context"
+	"effective-mobile-test-task/internal/model"
+	"time"
+)
+
+type EnrichmentJobRepo interface {
+	Claim(ctx context.Context, limit int, lease time.Duration) ([]model.EnrichmentJob, error)
+	Complete(ctx context.Context, jobID int64) error
+	Retry(ctx context.Context, jobID int64, delay time.Duration, reason string) error
+	Defer(ctx context.Context, jobID int64, delay time.Duration, reason string) error
+	Fail(ctx context.Context, job *model.EnrichmentJob, reason string) error
+	RequeueIncomplete(ctx context.Context) (int64, error)
+}
@@ -0,0 +1,14 @@
+package repository
+
+import (
+	"context"
+	"effective-mobile-test-task/internal/model"
+	"time"
+)
+
+type IdempotencyRepo interface {
+	Reserve(ctx context.Context, rec *model.IdempotencyRecord) (*model.IdempotencyRecord, error)
+	Complete(ctx context.Context, scope, key string, statusCode int, response []byte, ttl time.Duration) error
+	Release(ctx context.Context, scope, key string) error
+	DeleteExpired(ctx context.Context, limit int) (int64, error)
+}
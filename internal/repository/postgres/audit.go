@@ -0,0 +1,24 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/rs/zerolog/hlog"
+)
+
+// beginAuditTx открывает транзакцию и передает триггеру истории изменений users ID текущего запроса.
+// Вне HTTP-запроса (фоновое обогащение) request_id в истории остается пустым
+func beginAuditTx(ctx context.Context, db *sql.DB) (*sql.Tx, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	if id, ok := hlog.IDFromCtx(ctx); ok {
+		if _, err = tx.ExecContext(ctx, "SELECT set_config('app.request_id', $1, true)", id.String()); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+	return tx, nil
+}
@@ -0,0 +1,177 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"effective-mobile-test-task/internal/apperror"
+	"effective-mobile-test-task/internal/model"
+	"effective-mobile-test-task/internal/repository"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+type enrichmentJobRepo struct {
+	db *sql.DB
+}
+
+func NewEnrichmentJobRepo(db *sql.DB) (repository.EnrichmentJobRepo, error) {
+	if db == nil {
+		return nil, apperror.NewAppError("NewEnrichmentJobRepo", "db instnce is not initialize", nil)
+	}
+	return &enrichmentJobRepo{db: db}, nil
+}
+
+// Claim забирает готовые к выполнению задачи и откладывает их на время lease.
+// SKIP LOCKED позволяет нескольким воркерам разбирать очередь без блокировок,
+// а если воркер упадет, задача снова станет доступна по истечении lease
+func (r *enrichmentJobRepo) Claim(ctx context.Context, limit int, lease time.Duration) ([]model.EnrichmentJob, error) {
+	log := zerolog.Ctx(ctx).With().Str("method", "enrichmentJobRepo.Claim").Logger()
+
+	query := `
+		WITH claimed AS (
+			SELECT id FROM enrichment_jobs
+			WHERE run_at <= NOW()
+			ORDER BY run_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		UPDATE enrichment_jobs j
+		SET attempts = j.attempts + 1, run_at = NOW() + $2::interval
+		FROM claimed, users u
+		WHERE j.id = claimed.id AND u.uuid = j.user_uuid
+		RETURNING j.id, j.user_uuid, COALESCE(u.name_latin, u.name), j.attempts, j.bypass_cache`
+	args := []interface{}{limit, interval(lease)}
+
+	log.Debug().Interface("args", args).Msg("executing SQL query")
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, apperror.NewAppError("enrichmentJobRepo.Claim", "failed query", err)
+	}
+	defer rows.Close()
+
+	jobs := make([]model.EnrichmentJob, 0)
+	for rows.Next() {
+		var j model.EnrichmentJob
+		if err := rows.Scan(&j.ID, &j.UserUUID, &j.Name, &j.Attempts, &j.BypassCache); err != nil {
+			return nil, apperror.NewAppError("enrichmentJobRepo.Claim", "failed scan", err)
+		}
+		jobs = append(jobs, j)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, apperror.NewAppError("enrichmentJobRepo.Claim", "rows interation error", err)
+	}
+
+	if len(jobs) > 0 {
+		log.Debug().Int("jobs", len(jobs)).Msg("enrichment jobs claimed")
+	}
+
+	return jobs, nil
+}
+
+func (r *enrichmentJobRepo) Complete(ctx context.Context, jobID int64) error {
+	log := zerolog.Ctx(ctx).With().Str("method", "enrichmentJobRepo.Complete").Logger()
+
+	log.Debug().Int64("job_id", jobID).Msg("executing SQL query to delete enrichment job")
+	if _, err := r.db.ExecContext(ctx, "DELETE FROM enrichment_jobs WHERE id = $1", jobID); err != nil {
+		return apperror.NewAppError("enrichmentJobRepo.Complete", "failed exec", err)
+	}
+
+	return nil
+}
+
+// Retry откладывает задачу на delay для повторной попытки
+func (r *enrichmentJobRepo) Retry(ctx context.Context, jobID int64, delay time.Duration, reason string) error {
+	log := zerolog.Ctx(ctx).With().Str("method", "enrichmentJobRepo.Retry").Logger()
+
+	log.Debug().Int64("job_id", jobID).Dur("delay", delay).Msg("executing SQL query to reschedule enrichment job")
+	_, err := r.db.ExecContext(ctx, "UPDATE enrichment_jobs SET run_at = NOW() + $2::interval, last_error = $3 WHERE id = $1",
+		jobID, interval(delay), reason)
+	if err != nil {
+		return apperror.NewAppError("enrichmentJobRepo.Retry", "failed exec", err)
+	}
+
+	return nil
+}
+
+// Defer откладывает задачу без расхода попытки: причина задержки не связана с ошибкой,
+// например исчерпана квота API
+func (r *enrichmentJobRepo) Defer(ctx context.Context, jobID int64, delay time.Duration, reason string) error {
+	log := zerolog.Ctx(ctx).With().Str("method", "enrichmentJobRepo.Defer").Logger()
+
+	log.Debug().Int64("job_id", jobID).Dur("delay", delay).Msg("executing SQL query to defer enrichment job")
+	_, err := r.db.ExecContext(ctx,
+		"UPDATE enrichment_jobs SET run_at = NOW() + $2::interval, last_error = $3, attempts = GREATEST(attempts - 1, 0) WHERE id = $1",
+		jobID, interval(delay), reason)
+	if err != nil {
+		return apperror.NewAppError("enrichmentJobRepo.Defer", "failed exec", err)
+	}
+
+	return nil
+}
+
+func (r *enrichmentJobRepo) Fail(ctx context.Context, job *model.EnrichmentJob, reason string) error {
+	log := zerolog.Ctx(ctx).With().Str("method", "enrichmentJobRepo.Fail").Logger()
+
+	tx, err := beginAuditTx(ctx, r.db)
+	if err != nil {
+		return apperror.NewAppError("enrichmentJobRepo.Fail", "error beginning transaction", err)
+	}
+	defer tx.Rollback()
+
+	log.Debug().Int64("job_id", job.ID).Str("reason", reason).Msg("executing SQL query to fail enrichment job")
+	if _, err = tx.ExecContext(ctx, "DELETE FROM enrichment_jobs WHERE id = $1", job.ID); err != nil {
+		return apperror.NewAppError("enrichmentJobRepo.Fail", "failed to delete job", err)
+	}
+	_, err = tx.ExecContext(ctx, "UPDATE users SET enrichment_status = $2 WHERE uuid = $1", job.UserUUID, model.EnrichmentFailed)
+	if err != nil {
+		return apperror.NewAppError("enrichmentJobRepo.Fail", "failed to update user status", err)
+	}
+	if err = tx.Commit(); err != nil {
+		return apperror.NewAppError("enrichmentJobRepo.Fail", "error commiting transaction", err)
+	}
+
+	log.Warn().Str("uuid", string(job.UserUUID)).Str("reason", reason).Msg("enrichment job failed")
+
+	return nil
+}
+
+// RequeueIncomplete ставит в очередь пользователей, у которых не заполнен возраст, пол или страна
+func (r *enrichmentJobRepo) RequeueIncomplete(ctx context.Context) (int64, error) {
+	log := zerolog.Ctx(ctx).With().Str("method", "enrichmentJobRepo.RequeueIncomplete").Logger()
+
+	query := `
+		WITH queued AS (
+			INSERT INTO enrichment_jobs (user_uuid)
+			SELECT uuid FROM users
+			WHERE (age IS NULL OR gender IS NULL OR country_id IS NULL) AND deleted_at IS NULL
+			ON CONFLICT (user_uuid) DO NOTHING
+			RETURNING user_uuid
+		)
+		UPDATE users SET enrichment_status = $1
+		FROM queued
+		WHERE users.uuid = queued.user_uuid`
+
+	tx, err := beginAuditTx(ctx, r.db)
+	if err != nil {
+		return 0, apperror.NewAppError("enrichmentJobRepo.RequeueIncomplete", "error beginning transaction", err)
+	}
+	defer tx.Rollback()
+
+	log.Debug().Msg("executing SQL query to requeue incomplete users")
+	result, err := tx.ExecContext(ctx, query, model.EnrichmentPending)
+	if err != nil {
+		return 0, apperror.NewAppError("enrichmentJobRepo.RequeueIncomplete", "failed exec", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, apperror.NewAppError("enrichmentJobRepo.RequeueIncomplete", "can't get affectedRows count", err)
+	}
+	if err = tx.Commit(); err != nil {
+		return 0, apperror.NewAppError("enrichmentJobRepo.RequeueIncomplete", "error commiting transaction", err)
+	}
+
+	log.Info().Int64("queued", affected).Msg("incomplete users requeued for enrichment")
+
+	return affected, nil
+}
@@ -0,0 +1,115 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"effective-mobile-test-task/internal/apperror"
+	"effective-mobile-test-task/internal/model"
+	"effective-mobile-test-task/internal/repository"
+	"errors"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+type idempotencyRepo struct {
+	db *sql.DB
+}
+
+func NewIdempotencyRepo(db *sql.DB) (repository.IdempotencyRepo, error) {
+	if db == nil {
+		return nil, apperror.NewAppError("NewIdempotencyRepo", "db instnce is not initialize", nil)
+	}
+	return &idempotencyRepo{db: db}, nil
+}
+
+// Reserve занимает ключ на rec.TTL. Если ключ уже занят и не истек,
+// возвращает существующую запись, nil - ключ занят этим вызовом
+func (r *idempotencyRepo) Reserve(ctx context.Context, rec *model.IdempotencyRecord) (*model.IdempotencyRecord, error) {
+	log := zerolog.Ctx(ctx).With().Str("method", "idempotencyRepo.Reserve").Logger()
+
+	// истекшая запись перезаписывается, как если бы ключ встретился впервые
+	query := `
+		INSERT INTO idempotency_keys (scope, key, request_hash, expires_at)
+		VALUES ($1, $2, $3, NOW() + $4::interval)
+		ON CONFLICT (scope, key) DO UPDATE
+		SET request_hash = EXCLUDED.request_hash, status_code = NULL, response = NULL, expires_at = EXCLUDED.expires_at, created_at = NOW()
+		WHERE idempotency_keys.expires_at <= NOW()
+		RETURNING key`
+
+	log.Debug().Str("scope", rec.Scope).Str("key", rec.Key).Msg("executing SQL query to reserve idempotency key")
+	var key string
+	err := r.db.QueryRowContext(ctx, query, rec.Scope, rec.Key, rec.RequestHash, interval(rec.TTL)).Scan(&key)
+	if err == nil {
+		return nil, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, apperror.NewAppError("idempotencyRepo.Reserve", "failed query", err)
+	}
+
+	existing := &model.IdempotencyRecord{Scope: rec.Scope, Key: rec.Key}
+	err = r.db.QueryRowContext(ctx,
+		"SELECT request_hash, status_code, response FROM idempotency_keys WHERE scope = $1 AND key = $2",
+		rec.Scope, rec.Key).Scan(&existing.RequestHash, &existing.StatusCode, &existing.Response)
+	if err != nil {
+		return nil, apperror.NewAppError("idempotencyRepo.Reserve", "failed to get existing key", err)
+	}
+
+	log.Debug().Str("key", rec.Key).Bool("in_progress", existing.InProgress()).Msg("idempotency key already used")
+
+	return existing, nil
+}
+
+// Complete сохраняет ответ запроса и продлевает хранение ключа на ttl
+func (r *idempotencyRepo) Complete(ctx context.Context, scope, key string, statusCode int, response []byte, ttl time.Duration) error {
+	log := zerolog.Ctx(ctx).With().Str("method", "idempotencyRepo.Complete").Logger()
+
+	log.Debug().Str("key", key).Int("status", statusCode).Msg("executing SQL query to save idempotent response")
+	_, err := r.db.ExecContext(ctx,
+		"UPDATE idempotency_keys SET status_code = $3, response = $4, expires_at = NOW() + $5::interval WHERE scope = $1 AND key = $2",
+		scope, key, statusCode, response, interval(ttl))
+	if err != nil {
+		return apperror.NewAppError("idempotencyRepo.Complete", "failed exec", err)
+	}
+
+	return nil
+}
+
+// Release освобождает ключ незавершенного запроса, чтобы его можно было повторить
+func (r *idempotencyRepo) Release(ctx context.Context, scope, key string) error {
+	log := zerolog.Ctx(ctx).With().Str("method", "idempotencyRepo.Release").Logger()
+
+	log.Debug().Str("key", key).Msg("executing SQL query to release idempotency key")
+	_, err := r.db.ExecContext(ctx, "DELETE FROM idempotency_keys WHERE scope = $1 AND key = $2 AND status_code IS NULL", scope, key)
+	if err != nil {
+		return apperror.NewAppError("idempotencyRepo.Release", "failed exec", err)
+	}
+
+	return nil
+}
+
+// DeleteExpired удаляет не более limit истекших ключей
+func (r *idempotencyRepo) DeleteExpired(ctx context.Context, limit int) (int64, error) {
+	log := zerolog.Ctx(ctx).With().Str("method", "idempotencyRepo.DeleteExpired").Logger()
+
+	query := `
+		DELETE FROM idempotency_keys
+		WHERE (scope, key) IN (
+			SELECT scope, key FROM idempotency_keys
+			WHERE expires_at <= NOW()
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)`
+
+	log.Debug().Int("limit", limit).Msg("executing SQL query to delete expired idempotency keys")
+	result, err := r.db.ExecContext(ctx, query, limit)
+	if err != nil {
+		return 0, apperror.NewAppError("idempotencyRepo.DeleteExpired", "failed exec", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, apperror.NewAppError("idempotencyRepo.DeleteExpired", "can't get affectedRows count", err)
+	}
+
+	return affected, nil
+}
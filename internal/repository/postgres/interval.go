@@ -0,0 +1,13 @@
+package postgres
+
+import (
+	"fmt"
+	"time"
+)
+
+// interval передает длительность в запрос как PostgreSQL interval. Сроки считаются
+// в запросе от NOW(): колонки TIMESTAMP WITHOUT TIME ZONE хранят время в часовом поясе
+// сессии, и момент, посчитанный в Go, с ними не сравним
+func interval(d time.Duration) string {
+	return fmt.Sprintf("%d milliseconds", d.Milliseconds())
+}
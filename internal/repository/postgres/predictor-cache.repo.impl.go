@@ -0,0 +1,91 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"effective-mobile-test-task/internal/apperror"
+	"effective-mobile-test-task/internal/model"
+	"effective-mobile-test-task/internal/repository"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/lib/pq"
+	"github.com/rs/zerolog"
+)
+
+type predictorCacheRepo struct {
+	db *sql.DB
+}
+
+func NewPredictorCacheRepo(db *sql.DB) (repository.PredictorCacheRepo, error) {
+	if db == nil {
+		return nil, apperror.NewAppError("NewPredictorCacheRepo", "db instnce is not initialize", nil)
+	}
+	return &predictorCacheRepo{db: db}, nil
+}
+
+func (r *predictorCacheRepo) Get(ctx context.Context, api string, names []string) (map[string]model.PredictionCacheEntry, error) {
+	log := zerolog.Ctx(ctx).With().Str("method", "predictorCacheRepo.Get").Logger()
+
+	entries := make(map[string]model.PredictionCacheEntry, len(names))
+	if len(names) == 0 {
+		return entries, nil
+	}
+
+	query := `
+		SELECT api, name, response, known, EXTRACT(EPOCH FROM expires_at - NOW())
+		FROM predictor_cache
+		WHERE api = $1 AND name = ANY($2) AND expires_at > NOW()`
+
+	log.Debug().Str("query", query).Str("api", api).Int("names", len(names)).Msg("executing SQL query")
+	rows, err := r.db.QueryContext(ctx, query, api, pq.Array(names))
+	if err != nil {
+		return nil, apperror.NewAppError("predictorCacheRepo.Get", "failed query", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e model.PredictionCacheEntry
+		var ttl float64
+		if err := rows.Scan(&e.API, &e.Name, &e.Response, &e.Known, &ttl); err != nil {
+			return nil, apperror.NewAppError("predictorCacheRepo.Get", "failed scan", err)
+		}
+		e.TTL = time.Duration(ttl * float64(time.Second))
+		entries[e.Name] = e
+	}
+	if err := rows.Err(); err != nil {
+		return nil, apperror.NewAppError("predictorCacheRepo.Get", "rows interation error", err)
+	}
+
+	log.Debug().Int("found", len(entries)).Msg("cache entries found into database")
+
+	return entries, nil
+}
+
+func (r *predictorCacheRepo) Set(ctx context.Context, entries []model.PredictionCacheEntry) error {
+	log := zerolog.Ctx(ctx).With().Str("method", "predictorCacheRepo.Set").Logger()
+
+	if len(entries) == 0 {
+		return nil
+	}
+
+	builder := sq.Insert("predictor_cache").
+		PlaceholderFormat(sq.Dollar).
+		Columns("api", "name", "response", "known", "expires_at").
+		Suffix("ON CONFLICT (api, name) DO UPDATE SET response = EXCLUDED.response, known = EXCLUDED.known, expires_at = EXCLUDED.expires_at, updated_at = NOW()")
+	for _, e := range entries {
+		builder = builder.Values(e.API, e.Name, e.Response, e.Known, sq.Expr("NOW() + ?::interval", interval(e.TTL)))
+	}
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return apperror.NewAppError("predictorCacheRepo.Set", "failed sql build", err)
+	}
+
+	log.Debug().Str("query", query).Int("entries", len(entries)).Msg("executing SQL query")
+	if _, err := r.db.ExecContext(ctx, query, args...); err != nil {
+		return apperror.NewAppError("predictorCacheRepo.Set", "failed exec", err)
+	}
+
+	return nil
+}
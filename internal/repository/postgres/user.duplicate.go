@@ -0,0 +1,336 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"effective-mobile-test-task/internal/apperror"
+	"effective-mobile-test-task/internal/model"
+	"effective-mobile-test-task/internal/types"
+	"hash/fnv"
+	"slices"
+	"strings"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/lib/pq"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// duplicateSimilarity минимальная триграммная похожесть имени и фамилии при нечетком поиске дубликатов
+	duplicateSimilarity = 0.6
+	// maxDuplicates ограничивает количество возвращаемых дубликатов
+	maxDuplicates = 5
+	// duplicateLockSpace пространство advisory-блокировок проверки дубликатов
+	duplicateLockSpace = 0x64757073
+	// duplicateLockBuckets количество ключей блокировки: ФИО хэшируется в один из них,
+	// поэтому пакетное создание берет ограниченное число блокировок
+	duplicateLockBuckets = 256
+)
+
+// mergeColumns колонки, которые переносятся при слиянии вместе с полем
+var mergeColumns = map[string][]string{
+	model.Patronymic: {"patronymic", "patronymic_latin"},
+	model.Age:        {"age", "age_count"},
+	model.Gender:     {"gender", "gender_probability", "gender_count"},
+	model.CountryId:  {"country_id", "country_probability", "country_count"},
+}
+
+// querier выполняет запросы в БД или в транзакции
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// lockDuplicates до конца транзакции блокирует проверку дубликатов для переданных ФИО,
+// чтобы параллельные создания одного пользователя не проходили проверку одновременно.
+// Ключи берутся по возрастанию, поэтому пакеты не блокируют друг друга взаимно.
+// Нечеткие дубликаты с другим написанием имени или фамилии блокировкой не упорядочиваются
+func lockDuplicates(ctx context.Context, tx *sql.Tx, names ...*model.LatinNames) error {
+	log := zerolog.Ctx(ctx).With().Str("method", "lockDuplicates").Logger()
+
+	seen := make(map[int32]struct{}, len(names))
+	keys := make([]int32, 0, len(names))
+	for _, n := range names {
+		h := fnv.New32a()
+		h.Write([]byte(strings.ToLower(string(n.NameLatin) + " " + string(n.SurnameLatin))))
+		key := int32(h.Sum32() % duplicateLockBuckets)
+		if _, ok := seen[key]; !ok {
+			seen[key] = struct{}{}
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+
+	log.Debug().Int("keys", len(keys)).Msg("acquiring duplicate check locks")
+	for _, key := range keys {
+		if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock($1, $2)", duplicateLockSpace, key); err != nil {
+			return apperror.NewAppError("lockDuplicates", "failed to acquire duplicate check lock", err)
+		}
+	}
+	return nil
+}
+
+// findDuplicates ищет неудаленных пользователей с тем же ФИО в транслитерации.
+// При fuzzy=true имя и фамилия сравниваются по триграммной похожести, а отсутствующее
+// у одного из пользователей отчество не мешает совпадению. Первыми идут пользователи,
+// которые сами не являются дубликатами
+func findDuplicates(ctx context.Context, q querier, names *model.LatinNames, fuzzy bool) ([]types.UUID, error) {
+	log := zerolog.Ctx(ctx).With().Str("method", "findDuplicates").Logger()
+
+	builder := sq.Select("uuid").
+		From("users").
+		PlaceholderFormat(sq.Dollar).
+		Where(sq.Eq{"deleted_at": nil}).
+		OrderBy("duplicate_of IS NULL DESC").
+		Limit(maxDuplicates)
+
+	if fuzzy {
+		// % использует триграммные индексы, similarity задает порог строже стандартного
+		builder = builder.
+			Where("name_latin % ? AND similarity(name_latin, ?) >= ?", names.NameLatin, names.NameLatin, duplicateSimilarity).
+			Where("surname_latin % ? AND similarity(surname_latin, ?) >= ?", names.SurnameLatin, names.SurnameLatin, duplicateSimilarity).
+			OrderByClause("similarity(name_latin, ?) + similarity(surname_latin, ?) DESC", names.NameLatin, names.SurnameLatin)
+		if names.PatronymicLatin != nil {
+			builder = builder.Where("(patronymic_latin IS NULL OR similarity(patronymic_latin, ?) >= ?)", *names.PatronymicLatin, duplicateSimilarity)
+		}
+	} else {
+		builder = builder.
+			Where(sq.Eq{"name_latin": names.NameLatin, "surname_latin": names.SurnameLatin}).
+			Where("patronymic_latin IS NOT DISTINCT FROM ?", names.PatronymicLatin)
+	}
+	builder = builder.OrderBy("created_at")
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return nil, apperror.NewAppError("findDuplicates", "failed sql build", err)
+	}
+
+	log.Debug().Str("query", query).Interface("args", args).Msg("executing SQL query")
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, apperror.NewAppError("findDuplicates", "failed query", err)
+	}
+	defer rows.Close()
+
+	duplicates := make([]types.UUID, 0)
+	for rows.Next() {
+		var uuid types.UUID
+		if err := rows.Scan(&uuid); err != nil {
+			return nil, apperror.NewAppError("findDuplicates", "failed scan", err)
+		}
+		duplicates = append(duplicates, uuid)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, apperror.NewAppError("findDuplicates", "rows interation error", err)
+	}
+
+	log.Debug().Int("duplicates", len(duplicates)).Bool("fuzzy", fuzzy).Msg("duplicates search finished")
+
+	return duplicates, nil
+}
+
+// findBatchDuplicates ищет точные дубликаты для каждого пользователя пакета одним запросом.
+// Пользователь без дубликатов в БД считается дубликатом предыдущего пользователя пакета с тем же ФИО
+func findBatchDuplicates(ctx context.Context, q querier, users []model.UserCreate) ([][]types.UUID, error) {
+	log := zerolog.Ctx(ctx).With().Str("method", "findBatchDuplicates").Logger()
+
+	names := make([]string, len(users))
+	surnames := make([]string, len(users))
+	patronymics := make([]sql.NullString, len(users))
+	for i, u := range users {
+		names[i] = string(u.NameLatin)
+		surnames[i] = string(u.SurnameLatin)
+		if u.PatronymicLatin != nil {
+			patronymics[i] = sql.NullString{String: string(*u.PatronymicLatin), Valid: true}
+		}
+	}
+
+	query := `
+		SELECT b.idx, u.uuid
+		FROM unnest($1::text[], $2::text[], $3::text[]) WITH ORDINALITY AS b(name_latin, surname_latin, patronymic_latin, idx)
+		JOIN users u ON u.deleted_at IS NULL
+			AND u.name_latin = b.name_latin
+			AND u.surname_latin = b.surname_latin
+			AND u.patronymic_latin IS NOT DISTINCT FROM b.patronymic_latin
+		ORDER BY b.idx, u.duplicate_of IS NULL DESC, u.created_at`
+
+	log.Debug().Int("users", len(users)).Msg("executing SQL query")
+	rows, err := q.QueryContext(ctx, query, pq.Array(names), pq.Array(surnames), pq.Array(patronymics))
+	if err != nil {
+		return nil, apperror.NewAppError("findBatchDuplicates", "failed query", err)
+	}
+	defer rows.Close()
+
+	duplicates := make([][]types.UUID, len(users))
+	for rows.Next() {
+		var idx int
+		var uuid types.UUID
+		if err := rows.Scan(&idx, &uuid); err != nil {
+			return nil, apperror.NewAppError("findBatchDuplicates", "failed scan", err)
+		}
+		if len(duplicates[idx-1]) < maxDuplicates {
+			duplicates[idx-1] = append(duplicates[idx-1], uuid)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, apperror.NewAppError("findBatchDuplicates", "rows interation error", err)
+	}
+
+	first := make(map[string]types.UUID, len(users))
+	for i, u := range users {
+		key := names[i] + "\x00" + surnames[i] + "\x00" + patronymics[i].String
+		uuid, ok := first[key]
+		switch {
+		case !ok:
+			first[key] = u.UUID
+		case len(duplicates[i]) == 0:
+			duplicates[i] = []types.UUID{uuid}
+		}
+	}
+
+	return duplicates, nil
+}
+
+// Merge переносит поля Source в Target вместе с достоверностью, причинами проверки
+// и происхождением, затем мягко удаляет Source со ссылкой на Target. Ссылки других
+// дубликатов на Source переводятся на Target. Возвращает новую версию Target,
+// nil - один из пользователей не найден или изменился после чтения
+func (r *userRepo) Merge(ctx context.Context, m *model.UserMerge) (*types.Version, error) {
+	log := zerolog.Ctx(ctx).With().Str("method", "userRepo.Merge").Logger()
+
+	tx, err := beginAuditTx(ctx, r.db)
+	if err != nil {
+		return nil, apperror.NewAppError("userRepo.Merge", "error beginning transaction", err)
+	}
+	defer tx.Rollback()
+
+	// блокировка в порядке uuid исключает взаимную блокировку встречных слияний
+	rows, err := tx.QueryContext(ctx, "SELECT uuid, version FROM users WHERE uuid IN ($1, $2) AND deleted_at IS NULL ORDER BY uuid FOR UPDATE",
+		m.TargetUUID, m.SourceUUID)
+	if err != nil {
+		return nil, apperror.NewAppError("userRepo.Merge", "failed to lock users", err)
+	}
+	versions := make(map[types.UUID]types.Version, 2)
+	for rows.Next() {
+		var uuid types.UUID
+		var version types.Version
+		if err := rows.Scan(&uuid, &version); err != nil {
+			rows.Close()
+			return nil, apperror.NewAppError("userRepo.Merge", "failed scan", err)
+		}
+		versions[uuid] = version
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, apperror.NewAppError("userRepo.Merge", "rows interation error", err)
+	}
+	if v, ok := versions[m.TargetUUID]; !ok || v != m.TargetVersion {
+		log.Debug().Str("uuid", string(m.TargetUUID)).Msg("target user not found or version mismatch")
+		return nil, nil
+	}
+	if v, ok := versions[m.SourceUUID]; !ok || v != m.SourceVersion {
+		log.Debug().Str("uuid", string(m.SourceUUID)).Msg("source user not found or version mismatch")
+		return nil, nil
+	}
+
+	if len(m.Fields) > 0 {
+		if err = r.mergeFields(ctx, tx, m); err != nil {
+			return nil, err
+		}
+	}
+
+	log.Debug().Str("source", string(m.SourceUUID)).Msg("executing SQL query to soft delete merged user")
+	_, err = tx.ExecContext(ctx, "UPDATE users SET deleted_at = NOW(), duplicate_of = $1 WHERE uuid = $2", m.TargetUUID, m.SourceUUID)
+	if err != nil {
+		return nil, apperror.NewAppError("userRepo.Merge", "failed to delete source user", err)
+	}
+	if _, err = tx.ExecContext(ctx, "DELETE FROM enrichment_jobs WHERE user_uuid = $1", m.SourceUUID); err != nil {
+		return nil, apperror.NewAppError("userRepo.Merge", "failed to delete source enrichment job", err)
+	}
+	_, err = tx.ExecContext(ctx, "UPDATE users SET duplicate_of = CASE WHEN uuid = $1 THEN NULL ELSE $1 END WHERE duplicate_of = $2",
+		m.TargetUUID, m.SourceUUID)
+	if err != nil {
+		return nil, apperror.NewAppError("userRepo.Merge", "failed to relink duplicates", err)
+	}
+	// версия Target берется после всех изменений, в том числе снятия его ссылки на Source
+	var version types.Version
+	err = tx.QueryRowContext(ctx, "SELECT version FROM users WHERE uuid = $1", m.TargetUUID).Scan(&version)
+	if err != nil {
+		return nil, apperror.NewAppError("userRepo.Merge", "failed to get target version", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, apperror.NewAppError("userRepo.Merge", "error commiting transaction", err)
+	}
+
+	log.Info().Str("target", string(m.TargetUUID)).Str("source", string(m.SourceUUID)).Strs("fields", m.Fields).Msg("users merged in database")
+
+	return &version, nil
+}
+
+// mergeFields копирует выбранные поля Source в Target и пересчитывает статус обогащения Target
+func (r *userRepo) mergeFields(ctx context.Context, tx *sql.Tx, m *model.UserMerge) error {
+	log := zerolog.Ctx(ctx).With().Str("method", "userRepo.mergeFields").Logger()
+
+	builder := sq.Update("users t").
+		PlaceholderFormat(sq.Dollar).
+		From("users s").
+		Where(sq.Eq{"t.uuid": m.TargetUUID, "s.uuid": m.SourceUUID})
+
+	fields := map[string]bool{}
+	for _, field := range m.Fields {
+		columns, ok := mergeColumns[field]
+		if !ok {
+			return apperror.NewAppError("userRepo.mergeFields", "field can't be merged: "+field, nil)
+		}
+		fields[field] = true
+		for _, column := range columns {
+			builder = builder.Set(column, sq.Expr("s."+column))
+		}
+	}
+	value := func(field string) sq.Sqlizer {
+		if fields[field] {
+			return sq.Expr("s." + field)
+		}
+		return sq.Expr("t." + field)
+	}
+
+	merged := pq.Array(m.Fields)
+	review := sq.Expr("(t.review_reasons - ?::text[]) || ?", merged, jsonbPick("s.review_reasons", merged))
+	status := enrichmentStatus(review, value(model.Age), value(model.Gender), value(model.CountryId))
+	builder = builder.
+		Set("review_reasons", review).
+		Set("provenance", sq.Expr("(t.provenance - ?::text[]) || ?", merged, jsonbPick("s.provenance", merged))).
+		Set("enrichment_status", sq.Expr("CASE WHEN t.enrichment_status IN (?, ?, ?) THEN ? ELSE t.enrichment_status END",
+			model.EnrichmentDone, model.EnrichmentIncomplete, model.EnrichmentNeedsReview, status))
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return apperror.NewAppError("userRepo.mergeFields", "failed build sql", err)
+	}
+
+	log.Debug().Str("query", query).Interface("args", args).Msg("executing SQL query")
+	if _, err = tx.ExecContext(ctx, query, args...); err != nil {
+		return apperror.NewAppError("userRepo.mergeFields", "failed exec", err)
+	}
+
+	if fields[model.CountryId] {
+		log.Debug().Msg("copying predicted countries")
+		if _, err = tx.ExecContext(ctx, "DELETE FROM user_countries WHERE user_uuid = $1", m.TargetUUID); err != nil {
+			return apperror.NewAppError("userRepo.mergeFields", "failed to clear countries", err)
+		}
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO user_countries (user_uuid, country_id, probability, position)
+			SELECT $1, country_id, probability, position FROM user_countries WHERE user_uuid = $2`,
+			m.TargetUUID, m.SourceUUID)
+		if err != nil {
+			return apperror.NewAppError("userRepo.mergeFields", "failed to copy countries", err)
+		}
+	}
+
+	return nil
+}
+
+// jsonbPick выражение с ключами keys объекта JSONB-колонки column
+func jsonbPick(column string, keys interface{}) sq.Sqlizer {
+	return sq.Expr("COALESCE((SELECT jsonb_object_agg(key, value) FROM jsonb_each("+column+") WHERE key = ANY(?::text[])), '{}'::jsonb)", keys)
+}
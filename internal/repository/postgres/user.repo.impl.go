@@ -7,12 +7,78 @@ import (
 	"effective-mobile-test-task/internal/model"
 	"effective-mobile-test-task/internal/repository"
 	"effective-mobile-test-task/internal/types"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"time"
 
 	sq "github.com/Masterminds/squirrel"
+	"github.com/lib/pq"
 	"github.com/rs/zerolog"
 )
 
+// insertChunkSize количество строк в одном INSERT: держит число параметров
+// запроса ниже лимита PostgreSQL (65535)
+const insertChunkSize = 1000
+
+var userColumns = []string{
+	"uuid", "name", "surname", "patronymic", "age", "gender", "country_id", "enrichment_status",
+	"COALESCE(name_latin, name)", "COALESCE(surname_latin, surname)", "patronymic_latin",
+	"age_count", "gender_probability", "gender_count", "country_probability", "country_count",
+	"review_reasons", "provenance", "duplicate_of", "deleted_at", "version", "created_at", "updated_at",
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanUser(row rowScanner, u *model.User) error {
+	var reviewReasons, provenance []byte
+	err := row.Scan(&u.UUID, &u.Name, &u.Surname, &u.Patronymic, &u.Age, &u.Gender, &u.CountryID, &u.EnrichmentStatus,
+		&u.NameLatin, &u.SurnameLatin, &u.PatronymicLatin,
+		&u.AgeCount, &u.GenderProbability, &u.GenderCount, &u.CountryProbability, &u.CountryCount,
+		&reviewReasons, &provenance, &u.DuplicateOf, &u.DeletedAt, &u.Version, &u.CreatedAt, &u.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	if err = json.Unmarshal(reviewReasons, &u.ReviewReasons); err != nil {
+		return err
+	}
+	return json.Unmarshal(provenance, &u.Provenance)
+}
+
+// jsonbObject сериализует map для записи в JSONB, nil записывается пустым объектом
+func jsonbObject[M ~map[string]V, V any](m M) (string, error) {
+	if len(m) == 0 {
+		return "{}", nil
+	}
+	b, err := json.Marshal(m)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// enrichmentStatus вычисляет статус обогащения по новым значениям полей: review, age, gender
+// и countryID - выражения для новых значений review_reasons и соответствующих колонок
+func enrichmentStatus(review, age, gender, countryID sq.Sqlizer) sq.Sqlizer {
+	return sq.Expr("CASE WHEN ? <> '{}'::jsonb THEN ? WHEN ? IS NULL OR ? IS NULL OR ? IS NULL THEN ? ELSE ? END",
+		review, model.EnrichmentNeedsReview, age, gender, countryID, model.EnrichmentIncomplete, model.EnrichmentDone)
+}
+
+// updatedValue выражение нового значения колонки при обновлении: текущее значение,
+// если поле не передано, NULL при очистке, иначе переданное значение
+func updatedValue[T any](column string, n types.Nullable[T]) sq.Sqlizer {
+	switch {
+	case !n.Set:
+		return sq.Expr(column)
+	case n.Value == nil:
+		return sq.Expr("NULL")
+	}
+	// COALESCE задает тип параметра по колонке
+	return sq.Expr("COALESCE(?, "+column+")", *n.Value)
+}
+
 type userRepo struct {
 	db *sql.DB
 }
@@ -24,179 +90,669 @@ func NewUserRepo(db *sql.DB) (repository.UserRepo, error) {
 	return &userRepo{db: db}, nil
 }
 
-func (r *userRepo) Find(ctx context.Context, uqo *model.UserQueryOptions) ([]model.User, int, error) {
+func (r *userRepo) Find(ctx context.Context, uqo *model.UserQueryOptions) (*model.UserPage, error) {
 	log := zerolog.Ctx(ctx).With().Str("method", "userRepo.Find").Logger()
 	log.Debug().Interface("userQueryOptions", uqo).Msg("building query for finding users")
 
-	users := make([]model.User, 0)
+	page := &model.UserPage{Users: make([]model.User, 0)}
 
 	if uqo == nil {
-		uqo = &model.UserQueryOptions{}
+		uqo = &model.UserQueryOptions{Pagination: model.Pagination{WithTotal: true}}
+	}
+	where := userFilterConditions(&uqo.Filter)
+
+	if uqo.WithTotal {
+		countQuery, countArgs, err := sq.Select("COUNT(*)").
+			From("users").
+			PlaceholderFormat(sq.Dollar).
+			Where(where).
+			ToSql()
+		if err != nil {
+			return nil, apperror.NewAppError("userRepo.Find", "failed count sql build", err)
+		}
+
+		var totalCount int
+		log.Debug().Str("countQuery", countQuery).Interface("countArgs", countArgs).Msg("executing SQL query for count total rows")
+		err = r.db.QueryRowContext(ctx, countQuery, countArgs...).Scan(&totalCount)
+		if err != nil {
+			return nil, apperror.NewAppError("userRepo.Find", "failed count query", err)
+		}
+		page.Total = &totalCount
 	}
-	countBuilder := sq.Select("COUNT(*)").
-		From("users").
-		PlaceholderFormat(sq.Dollar)
 
 	limit := uqo.GetLimit()
-	offset := (uqo.GetPage() - 1) * limit
+	orderBy := uqo.GetOrderBy()
+	orderDir := uqo.GetOrderDir()
 
-	builder := sq.Select("uuid", "name", "surname", "patronymic", "age", "gender", "country_id", "created_at", "updated_at").
+	builder := sq.Select(userColumns...).
 		From("users").
 		PlaceholderFormat(sq.Dollar).
-		OrderBy(fmt.Sprintf("%s %s", uqo.GetOrderBy(), uqo.GetOrderDir())).
-		Offset(offset).
-		Limit(limit)
+		Where(where)
 
-	if uqo.Filter.Surname != nil {
-		countBuilder = countBuilder.Where(sq.Eq{"surname": *uqo.Filter.Surname})
-		builder = builder.Where(sq.Eq{"surname": *uqo.Filter.Surname})
-	}
-	if uqo.Filter.Patronymic != nil {
-		countBuilder = countBuilder.Where(sq.Eq{"patronymic": *uqo.Filter.Patronymic})
-		builder = builder.Where(sq.Eq{"patronymic": *uqo.Filter.Patronymic})
-	}
-	if uqo.Filter.Age != nil {
-		countBuilder = countBuilder.Where(sq.Eq{"age": *uqo.Filter.Age})
-		builder = builder.Where(sq.Eq{"age": *uqo.Filter.Age})
+	if uqo.Keyset {
+		if uqo.After != nil {
+			builder = builder.Where(keysetCondition(orderBy, orderDir, uqo.After))
+		}
+		// одна лишняя запись показывает, есть ли следующая страница
+		builder = builder.Limit(limit + 1)
+	} else {
+		builder = builder.Offset((uqo.GetPage() - 1) * limit).Limit(limit)
 	}
-	if uqo.Filter.Gender != nil {
-		countBuilder = countBuilder.Where(sq.Eq{"gender": *uqo.Filter.Gender})
-		builder = builder.Where(sq.Eq{"gender": *uqo.Filter.Gender})
+
+	if uqo.IsRelevanceOrder() {
+		rankSQL, rankArgs := searchRank(searchTerms(*uqo.Filter.Query))
+		builder = builder.OrderByClause(rankSQL+" DESC", rankArgs...)
 	}
-	if uqo.Filter.CountryID != nil {
-		countBuilder = countBuilder.Where(sq.Eq{"country_id": *uqo.Filter.CountryID})
-		builder = builder.Where(sq.Eq{"country_id": *uqo.Filter.CountryID})
+	builder = builder.OrderBy(fmt.Sprintf("%s %s NULLS LAST", orderBy, orderDir))
+	if orderBy != model.UUID {
+		builder = builder.OrderBy(fmt.Sprintf("uuid %s", orderDir))
 	}
 
-	var totalCount int
-	countQuery, countArgs, err := countBuilder.ToSql()
+	query, args, err := builder.ToSql()
 	if err != nil {
-		return nil, 0, apperror.NewAppError("userRepo.Find", "failed count sql build", err)
+		return nil, apperror.NewAppError("userRepo.Find", "failed sql build", err)
 	}
 
-	log.Debug().Str("countQuery", countQuery).Interface("countArgs", countArgs).Msg("executing SQL query for count total rows")
-	err = r.db.QueryRowContext(ctx, countQuery, countArgs...).Scan(&totalCount)
+	log.Debug().Str("query", query).Interface("args", args).Msg("executing SQL query")
+	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, 0, apperror.NewAppError("userRepo.Find", "failed count query", err)
+		return nil, apperror.NewAppError("userRepo.Find", "failed query", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var u model.User
+		if err := scanUser(rows, &u); err != nil {
+			return nil, apperror.NewAppError("userRepo.Find", "failed scan", err)
+		}
+		page.Users = append(page.Users, u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, apperror.NewAppError("userRepo.Find", "rows interation error", err)
+	}
+
+	if err := r.loadCountries(ctx, page.Users); err != nil {
+		return nil, err
+	}
+
+	if uqo.Keyset && uint64(len(page.Users)) > limit {
+		page.Users = page.Users[:limit]
+		last := page.Users[len(page.Users)-1]
+		cursor := (&model.Cursor{
+			OrderBy:  orderBy,
+			OrderDir: orderDir,
+			Value:    last.OrderValue(orderBy),
+			UUID:     last.UUID,
+		}).Encode()
+		page.NextCursor = &cursor
+	}
+
+	log.Debug().Interface("total_rows", page.Total).Int("page_rows", len(page.Users)).Msg("users found into database")
+
+	return page, nil
+}
+
+// keysetCondition отбирает записи, идущие после курсора при сортировке
+// "<поле> <направление> NULLS LAST, uuid <направление>"
+func keysetCondition(orderBy, orderDir string, c *model.Cursor) sq.Sqlizer {
+	op := ">"
+	if orderDir == model.DESC {
+		op = "<"
+	}
+	afterUUID := sq.Expr("uuid "+op+" ?", c.UUID)
+
+	if orderBy == model.UUID {
+		return afterUUID
+	}
+	if c.Value == nil {
+		return sq.And{sq.Expr(orderBy + " IS NULL"), afterUUID}
+	}
+	return sq.Or{
+		sq.Expr(orderBy+" "+op+" ?", *c.Value),
+		sq.And{sq.Expr(orderBy+" = ?", *c.Value), afterUUID},
+		sq.Expr(orderBy + " IS NULL"),
+	}
+}
+
+// sessionTime переводит момент времени в часовой пояс сессии: created_at и updated_at
+// заполняются NOW() и хранят время этого пояса без его указания
+const sessionTime = "?::timestamptz AT TIME ZONE current_setting('TimeZone')"
+
+func userFilterConditions(f *model.UserFilter) sq.And {
+	where := sq.And{}
+
+	if !f.IncludeDeleted {
+		where = append(where, sq.Eq{"deleted_at": nil})
+	}
+
+	// ФИО ищется как в исходном написании, так и в транслитерации
+	if f.Name != nil {
+		where = append(where, sq.Or{sq.Eq{"name": *f.Name}, sq.Eq{"name_latin": *f.Name}})
+	}
+	if f.Surname != nil {
+		where = append(where, sq.Or{sq.Eq{"surname": *f.Surname}, sq.Eq{"surname_latin": *f.Surname}})
+	}
+	if f.Patronymic != nil {
+		where = append(where, sq.Or{sq.Eq{"patronymic": *f.Patronymic}, sq.Eq{"patronymic_latin": *f.Patronymic}})
+	}
+	if f.Age != nil {
+		where = append(where, sq.Eq{"age": *f.Age})
+	}
+	if f.AgeMin != nil {
+		where = append(where, sq.GtOrEq{"age": *f.AgeMin})
+	}
+	if f.AgeMax != nil {
+		where = append(where, sq.LtOrEq{"age": *f.AgeMax})
 	}
+	if len(f.Genders) > 0 {
+		where = append(where, sq.Eq{"gender": f.Genders})
+	}
+	if len(f.CountryIDs) > 0 {
+		where = append(where, sq.Eq{"country_id": f.CountryIDs})
+	}
+	if f.CreatedFrom != nil {
+		where = append(where, sq.Expr("created_at >= "+sessionTime, *f.CreatedFrom))
+	}
+	if f.CreatedTo != nil {
+		where = append(where, sq.Expr("created_at <= "+sessionTime, *f.CreatedTo))
+	}
+	if f.UpdatedFrom != nil {
+		where = append(where, sq.Expr("updated_at >= "+sessionTime, *f.UpdatedFrom))
+	}
+	if f.UpdatedTo != nil {
+		where = append(where, sq.Expr("updated_at <= "+sessionTime, *f.UpdatedTo))
+	}
+	if len(f.EnrichmentStatuses) > 0 {
+		where = append(where, sq.Eq{"enrichment_status": f.EnrichmentStatuses})
+	}
+	if f.MinAgeCount != nil {
+		where = append(where, sq.GtOrEq{"age_count": *f.MinAgeCount})
+	}
+	if f.MinGenderProbability != nil {
+		where = append(where, sq.GtOrEq{"gender_probability": *f.MinGenderProbability})
+	}
+	if f.MinCountryProbability != nil {
+		where = append(where, sq.GtOrEq{"country_probability": *f.MinCountryProbability})
+	}
+	if f.Query != nil {
+		for _, term := range searchTerms(*f.Query) {
+			where = append(where, searchCondition(term))
+		}
+	}
+
+	return where
+}
+
+// FindByUUID ищет пользователя по ID. includeDeleted - искать также среди мягко удаленных
+func (r *userRepo) FindByUUID(ctx context.Context, uuid types.UUID, includeDeleted bool) (*model.User, error) {
+	log := zerolog.Ctx(ctx).With().Str("method", "userRepo.FindByUUID").Logger()
 
+	builder := sq.Select(userColumns...).
+		From("users").
+		PlaceholderFormat(sq.Dollar).
+		Where(sq.Eq{"uuid": uuid})
+	if !includeDeleted {
+		builder = builder.Where(sq.Eq{"deleted_at": nil})
+	}
 	query, args, err := builder.ToSql()
 	if err != nil {
-		return nil, 0, apperror.NewAppError("userRepo.Find", "failed sql build", err)
+		return nil, apperror.NewAppError("userRepo.FindByUUID", "failed sql build", err)
 	}
 
 	log.Debug().Str("query", query).Interface("args", args).Msg("executing SQL query")
-	rows, err := r.db.QueryContext(ctx, query, args...)
+	var u model.User
+	err = scanUser(r.db.QueryRowContext(ctx, query, args...), &u)
+	if errors.Is(err, sql.ErrNoRows) {
+		log.Debug().Str("uuid", string(uuid)).Msg("user not found in database")
+		return nil, nil
+	}
 	if err != nil {
-		return nil, 0, apperror.NewAppError("userRepo.Find", "failed query", err)
+		return nil, apperror.NewAppError("userRepo.FindByUUID", "failed query", err)
+	}
+
+	users := []model.User{u}
+	if err := r.loadCountries(ctx, users); err != nil {
+		return nil, err
+	}
+
+	log.Debug().Str("uuid", string(uuid)).Msg("user found in database")
+
+	return &users[0], nil
+}
+
+// loadCountries подгружает полный список предсказанных стран одним запросом на всю страницу
+func (r *userRepo) loadCountries(ctx context.Context, users []model.User) error {
+	log := zerolog.Ctx(ctx).With().Str("method", "userRepo.loadCountries").Logger()
+
+	if len(users) == 0 {
+		return nil
+	}
+
+	index := make(map[types.UUID]int, len(users))
+	uuids := make([]string, 0, len(users))
+	for i, u := range users {
+		index[u.UUID] = i
+		uuids = append(uuids, string(u.UUID))
+	}
+
+	query := "SELECT user_uuid, country_id, probability FROM user_countries WHERE user_uuid = ANY($1) ORDER BY user_uuid, position"
+
+	log.Debug().Str("query", query).Int("users", len(uuids)).Msg("executing SQL query")
+	rows, err := r.db.QueryContext(ctx, query, pq.Array(uuids))
+	if err != nil {
+		return apperror.NewAppError("userRepo.loadCountries", "failed query", err)
 	}
 	defer rows.Close()
 
 	for rows.Next() {
-		var u model.User
-		if err := rows.Scan(&u.UUID, &u.Name, &u.Surname, &u.Patronymic, &u.Age, &u.Gender, &u.CountryID, &u.CreatedAt, &u.UpdatedAt); err != nil {
-			return nil, 0, apperror.NewAppError("userRepo.Find", "failed scan", err)
+		var userUUID types.UUID
+		var c model.CountryProbability
+		if err := rows.Scan(&userUUID, &c.CountryID, &c.Probability); err != nil {
+			return apperror.NewAppError("userRepo.loadCountries", "failed scan", err)
+		}
+		if i, ok := index[userUUID]; ok {
+			users[i].Countries = append(users[i].Countries, c)
 		}
-		users = append(users, u)
 	}
 	if err := rows.Err(); err != nil {
-		return nil, 0, apperror.NewAppError("userRepo.Find", "rows interation error", err)
+		return apperror.NewAppError("userRepo.loadCountries", "rows interation error", err)
 	}
 
-	log.Debug().Int("total_rows", totalCount).Int("page_rows", len(users)).Msg("users found into database")
-
-	return users, totalCount, nil
+	return nil
 }
 
-func (r *userRepo) Insert(ctx context.Context, u *model.UserCreate) error {
+// Insert создает пользователя и ставит задачу обогащения, если проверка дубликатов это допускает.
+// Поиск дубликатов и вставка выполняются в одной транзакции под advisory-блокировкой по ФИО,
+// поэтому параллельные запросы с одним ФИО не создают двух пользователей. Возвращает найденные
+// дубликаты: при политике DuplicateReject пользователь в этом случае не создается, при
+// DuplicateLink создается со ссылкой u.DuplicateOf на первый из них
+func (r *userRepo) Insert(ctx context.Context, u *model.UserCreate, check model.DuplicateCheck) ([]types.UUID, error) {
 	log := zerolog.Ctx(ctx).With().Str("method", "userRepo.Insert").Logger()
 	log.Debug().Interface("user", u).Msg("starting transaction to insert user")
 
-	query := "INSERT INTO users (uuid, name, surname, patronymic, age, gender, country_id) VALUES ($1, $2, $3, $4, $5, $6, $7)"
-	args := []interface{}{u.UUID, u.Name, u.Surname, u.Patronymic, u.Age, u.Gender, u.CountryID}
+	provenance, err := jsonbObject(u.Provenance)
+	if err != nil {
+		return nil, apperror.NewAppError("userRepo.Insert", "failed to marshal provenance", err)
+	}
 
-	tx, err := r.db.BeginTx(ctx, nil)
+	tx, err := beginAuditTx(ctx, r.db)
 	if err != nil {
-		return apperror.NewAppError("userRepo.Insert", "error beginning transaction", err)
+		return nil, apperror.NewAppError("userRepo.Insert", "error beginning transaction", err)
 	}
 	defer tx.Rollback()
 
+	if err = lockDuplicates(ctx, tx, &u.LatinNames); err != nil {
+		return nil, err
+	}
+	duplicates, err := findDuplicates(ctx, tx, &u.LatinNames, check.Fuzzy)
+	if err != nil {
+		return nil, err
+	}
+	if len(duplicates) > 0 {
+		if check.Policy != model.DuplicateLink {
+			log.Debug().Str("existing_uuid", string(duplicates[0])).Msg("duplicate found, user not inserted")
+			return duplicates, nil
+		}
+		u.DuplicateOf = &duplicates[0]
+	}
+
+	query := `
+		INSERT INTO users (uuid, name, surname, patronymic, name_latin, surname_latin, patronymic_latin, age, gender, country_id, provenance, duplicate_of)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`
+	args := []interface{}{u.UUID, u.Name, u.Surname, u.Patronymic, u.NameLatin, u.SurnameLatin, u.PatronymicLatin,
+		u.Age, u.Gender, u.CountryID, provenance, u.DuplicateOf}
+
 	log.Debug().Str("query", query).Interface("args", args).Msg("executing SQL query")
 	_, err = tx.ExecContext(ctx, query, args...)
 	if err != nil {
-		return apperror.NewAppError("userRepo.Insert", "failed query", err)
+		return nil, apperror.NewAppError("userRepo.Insert", "failed query", err)
+	}
+
+	log.Debug().Str("uuid", string(u.UUID)).Msg("enqueueing enrichment job")
+	_, err = tx.ExecContext(ctx, "INSERT INTO enrichment_jobs (user_uuid, bypass_cache) VALUES ($1, $2)", u.UUID, u.BypassCache)
+	if err != nil {
+		return nil, apperror.NewAppError("userRepo.Insert", "failed to enqueue enrichment job", err)
 	}
 	if err = tx.Commit(); err != nil {
-		return apperror.NewAppError("userRepo.Insert", "error commiting transaction", err)
+		return nil, apperror.NewAppError("userRepo.Insert", "error commiting transaction", err)
 	}
 	log.Info().Str("uuid", string(u.UUID)).Msg("user inserted into database")
 
-	return nil
+	return duplicates, nil
 }
 
-func (r *userRepo) Update(ctx context.Context, uuid types.UUID, u *model.UserUpdate) (int64, error) {
+// InsertMany создает пользователей одной транзакцией и ставит задачи обогащения.
+// Точные дубликаты ищутся для всего пакета под теми же блокировками, что и в Insert, включая
+// повторы ФИО внутри пакета. Возвращает дубликаты каждого пользователя: при политике
+// DuplicateReject такие пользователи не создаются, при DuplicateLink у них заполняется DuplicateOf
+func (r *userRepo) InsertMany(ctx context.Context, users []model.UserCreate, policy string) ([][]types.UUID, error) {
+	log := zerolog.Ctx(ctx).With().Str("method", "userRepo.InsertMany").Logger()
+	log.Debug().Int("count", len(users)).Msg("starting transaction to insert users")
+
+	if len(users) == 0 {
+		return nil, nil
+	}
+
+	tx, err := beginAuditTx(ctx, r.db)
+	if err != nil {
+		return nil, apperror.NewAppError("userRepo.InsertMany", "error beginning transaction", err)
+	}
+	defer tx.Rollback()
+
+	names := make([]*model.LatinNames, len(users))
+	for i := range users {
+		names[i] = &users[i].LatinNames
+	}
+	if err = lockDuplicates(ctx, tx, names...); err != nil {
+		return nil, err
+	}
+	duplicates, err := findBatchDuplicates(ctx, tx, users)
+	if err != nil {
+		return nil, err
+	}
+
+	inserted := make([]*model.UserCreate, 0, len(users))
+	for i := range users {
+		if len(duplicates[i]) > 0 {
+			if policy != model.DuplicateLink {
+				continue
+			}
+			users[i].DuplicateOf = &duplicates[i][0]
+		}
+		inserted = append(inserted, &users[i])
+	}
+	log.Debug().Int("count", len(inserted)).Int("rejected", len(users)-len(inserted)).Msg("duplicates checked")
+
+	for start := 0; start < len(inserted); start += insertChunkSize {
+		end := min(start+insertChunkSize, len(inserted))
+
+		builder := sq.Insert("users").
+			PlaceholderFormat(sq.Dollar).
+			Columns("uuid", "name", "surname", "patronymic", "name_latin", "surname_latin", "patronymic_latin",
+				"age", "gender", "country_id", "provenance", "duplicate_of")
+		for _, u := range inserted[start:end] {
+			provenance, err := jsonbObject(u.Provenance)
+			if err != nil {
+				return nil, apperror.NewAppError("userRepo.InsertMany", "failed to marshal provenance", err)
+			}
+			builder = builder.Values(u.UUID, u.Name, u.Surname, u.Patronymic, u.NameLatin, u.SurnameLatin, u.PatronymicLatin,
+				u.Age, u.Gender, u.CountryID, provenance, u.DuplicateOf)
+		}
+
+		query, args, err := builder.ToSql()
+		if err != nil {
+			return nil, apperror.NewAppError("userRepo.InsertMany", "failed sql build", err)
+		}
+
+		log.Debug().Int("from", start).Int("to", end).Msg("executing SQL query")
+		if _, err = tx.ExecContext(ctx, query, args...); err != nil {
+			return nil, apperror.NewAppError("userRepo.InsertMany", "failed query", err)
+		}
+
+		jobs := sq.Insert("enrichment_jobs").
+			PlaceholderFormat(sq.Dollar).
+			Columns("user_uuid", "bypass_cache")
+		for _, u := range inserted[start:end] {
+			jobs = jobs.Values(u.UUID, u.BypassCache)
+		}
+
+		query, args, err = jobs.ToSql()
+		if err != nil {
+			return nil, apperror.NewAppError("userRepo.InsertMany", "failed jobs sql build", err)
+		}
+
+		log.Debug().Int("from", start).Int("to", end).Msg("enqueueing enrichment jobs")
+		if _, err = tx.ExecContext(ctx, query, args...); err != nil {
+			return nil, apperror.NewAppError("userRepo.InsertMany", "failed to enqueue enrichment jobs", err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, apperror.NewAppError("userRepo.InsertMany", "error commiting transaction", err)
+	}
+	log.Info().Int("count", len(inserted)).Msg("users inserted into database")
+
+	return duplicates, nil
+}
+
+// Update изменяет пользователя и возвращает его новую версию. При заданном IfVersions
+// выполняется compare-and-set по версии. nil - пользователь не найден или версия не совпала
+func (r *userRepo) Update(ctx context.Context, uuid types.UUID, u *model.UserUpdate) (*types.Version, error) {
 	log := zerolog.Ctx(ctx).With().Str("method", "userRepo.Update").Logger()
 	log.Debug().Interface("user", u).Msg("building query for updating user")
 
-	builder := sq.Update("users").PlaceholderFormat(sq.Dollar).Where(sq.Eq{"uuid": uuid})
+	builder := sq.Update("users").
+		PlaceholderFormat(sq.Dollar).
+		Where(sq.Eq{"uuid": uuid, "deleted_at": nil}).
+		Suffix("RETURNING version")
+	if u.IfVersions != nil {
+		builder = builder.Where(sq.Eq{"version": u.IfVersions})
+	}
 
 	hasUpdates := false
+	// значения, установленные вручную, больше не требуют проверки
+	reviewed := []string{}
 
 	if u.Name != nil {
-		builder = builder.Set("name", *u.Name)
+		builder = builder.Set("name", *u.Name).Set("name_latin", u.NameLatin)
 		hasUpdates = true
 	}
 	if u.Surname != nil {
-		builder = builder.Set("surname", *u.Surname)
+		builder = builder.Set("surname", *u.Surname).Set("surname_latin", u.SurnameLatin)
 		hasUpdates = true
 	}
-	if u.Patronymic != nil {
-		builder = builder.Set("patronymic", *u.Patronymic)
+	if u.Patronymic.Set {
+		builder = builder.Set("patronymic", u.Patronymic.Value).Set("patronymic_latin", u.PatronymicLatin.Value)
 		hasUpdates = true
 	}
-	if u.Age != nil {
-		builder = builder.Set("age", *u.Age)
+	// достоверность относится к предсказанию, при ручной установке или очистке значения она сбрасывается
+	if u.Age.Set {
+		builder = builder.Set("age", u.Age.Value).Set("age_count", nil)
+		reviewed = append(reviewed, model.Age)
 		hasUpdates = true
 	}
-	if u.Gender != nil {
-		builder = builder.Set("gender", *u.Gender)
+	if u.Gender.Set {
+		builder = builder.Set("gender", u.Gender.Value).Set("gender_probability", nil).Set("gender_count", nil)
+		reviewed = append(reviewed, model.Gender)
 		hasUpdates = true
 	}
-	if u.CountryID != nil {
-		builder = builder.Set("country_id", *u.CountryID)
+	if u.CountryID.Set {
+		builder = builder.Set("country_id", u.CountryID.Value).Set("country_probability", nil).Set("country_count", nil)
+		reviewed = append(reviewed, model.CountryId)
 		hasUpdates = true
 	}
+	if len(u.Provenance) > 0 {
+		provenance, err := jsonbObject(u.Provenance)
+		if err != nil {
+			return nil, apperror.NewAppError("userRepo.Update", "failed to marshal provenance", err)
+		}
+		builder = builder.Set("provenance", sq.Expr("provenance || ?::jsonb", provenance))
+	}
+	if len(reviewed) > 0 {
+		review := sq.Expr("review_reasons - ?::text[]", pq.Array(reviewed))
+		status := enrichmentStatus(review, updatedValue("age", u.Age), updatedValue("gender", u.Gender), updatedValue("country_id", u.CountryID))
+		builder = builder.Set("review_reasons", review).
+			Set("enrichment_status", sq.Expr("CASE WHEN enrichment_status IN (?, ?, ?) THEN ? ELSE enrichment_status END",
+				model.EnrichmentDone, model.EnrichmentIncomplete, model.EnrichmentNeedsReview, status))
+	}
 
 	log.Debug().Bool("hasUpdates", hasUpdates).Msg("checking if any to update")
 	if !hasUpdates {
-		return 0, apperror.NewAppError("userRepo.Update", "no fields to update", nil)
+		return nil, apperror.NewAppError("userRepo.Update", "no fields to update", nil)
 	}
 
 	query, args, err := builder.ToSql()
 	if err != nil {
-		return 0, apperror.NewAppError("userRepo.Update", "failed build sql", err)
+		return nil, apperror.NewAppError("userRepo.Update", "failed build sql", err)
+	}
+
+	tx, err := beginAuditTx(ctx, r.db)
+	if err != nil {
+		return nil, apperror.NewAppError("userRepo.Update", "error beginning transaction", err)
 	}
+	defer tx.Rollback()
 
 	log.Debug().Str("query", query).Interface("args", args).Msg("executing SQL query")
-	result, err := r.db.ExecContext(ctx, query, args...)
+	var version types.Version
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&version)
+	if errors.Is(err, sql.ErrNoRows) {
+		log.Debug().Str("uuid", string(uuid)).Msg("user not found or version mismatch")
+		return nil, nil
+	}
 	if err != nil {
-		return 0, apperror.NewAppError("userRepo.Update", "failed exec", err)
+		return nil, apperror.NewAppError("userRepo.Update", "failed exec", err)
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, apperror.NewAppError("userRepo.Update", "error commiting transaction", err)
+	}
+
+	log.Info().Int64("version", int64(version)).Msg("user updated into database")
+
+	return &version, nil
+}
+
+// ApplyEnrichment записывает полученные предсказания, не затирая известные значения NULL-ами.
+// Поля, заданные вручную или импортированные, не перезаписываются.
+// При final=true статус обогащения вычисляется по заполненности полей, иначе остается pending
+func (r *userRepo) ApplyEnrichment(ctx context.Context, uuid types.UUID, e *model.UserEnrichment, final bool) (int64, error) {
+	log := zerolog.Ctx(ctx).With().Str("method", "userRepo.ApplyEnrichment").Logger()
+
+	tx, err := beginAuditTx(ctx, r.db)
+	if err != nil {
+		return 0, apperror.NewAppError("userRepo.ApplyEnrichment", "error beginning transaction", err)
+	}
+	defer tx.Rollback()
+
+	var rawProvenance []byte
+	err = tx.QueryRowContext(ctx, "SELECT provenance FROM users WHERE uuid = $1 AND deleted_at IS NULL FOR UPDATE", uuid).Scan(&rawProvenance)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, apperror.NewAppError("userRepo.ApplyEnrichment", "failed to lock user", err)
+	}
+	var current model.Provenance
+	if err = json.Unmarshal(rawProvenance, &current); err != nil {
+		return 0, apperror.NewAppError("userRepo.ApplyEnrichment", "failed to unmarshal provenance", err)
+	}
+	if locked := e.ExcludeLocked(current); len(locked) > 0 {
+		log.Debug().Str("uuid", string(uuid)).Strs("fields", locked).Msg("skipping manually set fields")
+	}
+
+	// поля с принятым предсказанием снимаются с проверки, отброшенные порогом - добавляются
+	resolved := []string{}
+	if e.Age != nil {
+		resolved = append(resolved, model.Age)
+	}
+	if e.Gender != nil {
+		resolved = append(resolved, model.Gender)
+	}
+	if e.CountryID != nil {
+		resolved = append(resolved, model.CountryId)
+	}
+	reasons, err := jsonbObject(e.Review)
+	if err != nil {
+		return 0, apperror.NewAppError("userRepo.ApplyEnrichment", "failed to marshal review reasons", err)
+	}
+	provenance, err := jsonbObject(e.Provenance)
+	if err != nil {
+		return 0, apperror.NewAppError("userRepo.ApplyEnrichment", "failed to marshal provenance", err)
+	}
+	review := sq.Expr("(review_reasons - ?::text[]) || ?::jsonb", pq.Array(resolved), reasons)
+
+	age := sq.Expr("COALESCE(?, age)", e.Age)
+	gender := sq.Expr("COALESCE(?, gender)", e.Gender)
+	countryID := sq.Expr("COALESCE(?, country_id)", e.CountryID)
+	status := sq.Expr("?", model.EnrichmentPending)
+	if final {
+		status = enrichmentStatus(review, age, gender, countryID)
+	}
+
+	query, args, err := sq.Update("users").
+		PlaceholderFormat(sq.Dollar).
+		Set("age", age).
+		Set("age_count", sq.Expr("COALESCE(?, age_count)", e.AgeCount)).
+		Set("gender", gender).
+		Set("gender_probability", sq.Expr("COALESCE(?, gender_probability)", e.GenderProbability)).
+		Set("gender_count", sq.Expr("COALESCE(?, gender_count)", e.GenderCount)).
+		Set("country_id", countryID).
+		Set("country_probability", sq.Expr("COALESCE(?, country_probability)", e.CountryProbability)).
+		Set("country_count", sq.Expr("COALESCE(?, country_count)", e.CountryCount)).
+		Set("review_reasons", review).
+		Set("provenance", sq.Expr("provenance || ?::jsonb", provenance)).
+		Set("enrichment_status", status).
+		Where(sq.Eq{"uuid": uuid}).
+		ToSql()
+	if err != nil {
+		return 0, apperror.NewAppError("userRepo.ApplyEnrichment", "failed build sql", err)
+	}
+
+	log.Debug().Str("query", query).Interface("args", args).Msg("executing SQL query")
+	result, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, apperror.NewAppError("userRepo.ApplyEnrichment", "failed exec", err)
 	}
 	affected, err := result.RowsAffected()
 	if err != nil {
-		return 0, apperror.NewAppError("userRepo.Update", "can't get affectedRows count", err)
+		return 0, apperror.NewAppError("userRepo.ApplyEnrichment", "can't get affectedRows count", err)
 	}
 
-	log.Info().Int64("affected rows", affected).Msg("user updated into database")
+	if affected > 0 && len(e.Countries) > 0 {
+		if _, err = tx.ExecContext(ctx, "DELETE FROM user_countries WHERE user_uuid = $1", uuid); err != nil {
+			return 0, apperror.NewAppError("userRepo.ApplyEnrichment", "failed to clear countries", err)
+		}
+
+		countries := sq.Insert("user_countries").
+			PlaceholderFormat(sq.Dollar).
+			Columns("user_uuid", "country_id", "probability", "position")
+		for i, c := range e.Countries {
+			countries = countries.Values(uuid, c.CountryID, c.Probability, i)
+		}
+		query, args, err := countries.ToSql()
+		if err != nil {
+			return 0, apperror.NewAppError("userRepo.ApplyEnrichment", "failed countries sql build", err)
+		}
+		if _, err = tx.ExecContext(ctx, query, args...); err != nil {
+			return 0, apperror.NewAppError("userRepo.ApplyEnrichment", "failed to insert countries", err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, apperror.NewAppError("userRepo.ApplyEnrichment", "error commiting transaction", err)
+	}
+
+	log.Debug().Str("uuid", string(uuid)).Int64("affected rows", affected).Bool("final", final).Msg("user enrichment applied")
 
 	return affected, nil
 }
 
-func (r *userRepo) Delete(ctx context.Context, uuid types.UUID) (int64, error) {
+// Delete мягко удаляет пользователя и снимает его задачу обогащения.
+// Окончательно строки удаляются PurgeDeleted по истечении срока хранения.
+// При заданном ifVersions пользователь удаляется, только если текущая версия входит в список
+func (r *userRepo) Delete(ctx context.Context, uuid types.UUID, ifVersions []types.Version) (int64, error) {
 	log := zerolog.Ctx(ctx).With().Str("method", "userRepo.Delete").Logger()
 
-	log.Debug().Str("uuid", string(uuid)).Msg("executing SQL query to delete user")
-	result, err := r.db.ExecContext(ctx, "DELETE FROM users WHERE uuid = $1", uuid)
+	tx, err := beginAuditTx(ctx, r.db)
+	if err != nil {
+		return 0, apperror.NewAppError("userRepo.Delete", "error beginning transaction", err)
+	}
+	defer tx.Rollback()
+
+	where := sq.Eq{"uuid": uuid, "deleted_at": nil}
+	if ifVersions != nil {
+		where["version"] = ifVersions
+	}
+	query, args, err := sq.Update("users").
+		PlaceholderFormat(sq.Dollar).
+		Set("deleted_at", sq.Expr("NOW()")).
+		Where(where).
+		ToSql()
+	if err != nil {
+		return 0, apperror.NewAppError("userRepo.Delete", "failed build sql", err)
+	}
+
+	log.Debug().Str("query", query).Interface("args", args).Msg("executing SQL query to soft delete user")
+	result, err := tx.ExecContext(ctx, query, args...)
 	if err != nil {
 		return 0, apperror.NewAppError("userRepo.Delete", "failed exec", err)
 	}
@@ -204,8 +760,127 @@ func (r *userRepo) Delete(ctx context.Context, uuid types.UUID) (int64, error) {
 	if err != nil {
 		return 0, apperror.NewAppError("userRepo.Delete", "can't get affectedRows count", err)
 	}
+	if affected > 0 {
+		if _, err = tx.ExecContext(ctx, "DELETE FROM enrichment_jobs WHERE user_uuid = $1", uuid); err != nil {
+			return 0, apperror.NewAppError("userRepo.Delete", "failed to delete enrichment job", err)
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return 0, apperror.NewAppError("userRepo.Delete", "error commiting transaction", err)
+	}
+
+	log.Info().Int64("affected rows", affected).Msg("user soft deleted from database")
+
+	return affected, nil
+}
+
+// Restore восстанавливает мягко удаленного пользователя. Если обогащение не было
+// завершено до удаления, задача ставится в очередь заново
+func (r *userRepo) Restore(ctx context.Context, uuid types.UUID) (int64, error) {
+	log := zerolog.Ctx(ctx).With().Str("method", "userRepo.Restore").Logger()
+
+	tx, err := beginAuditTx(ctx, r.db)
+	if err != nil {
+		return 0, apperror.NewAppError("userRepo.Restore", "error beginning transaction", err)
+	}
+	defer tx.Rollback()
+
+	log.Debug().Str("uuid", string(uuid)).Msg("executing SQL query to restore user")
+	result, err := tx.ExecContext(ctx, "UPDATE users SET deleted_at = NULL WHERE uuid = $1 AND deleted_at IS NOT NULL", uuid)
+	if err != nil {
+		return 0, apperror.NewAppError("userRepo.Restore", "failed exec", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, apperror.NewAppError("userRepo.Restore", "can't get affectedRows count", err)
+	}
+	if affected > 0 {
+		query := `
+			INSERT INTO enrichment_jobs (user_uuid)
+			SELECT uuid FROM users WHERE uuid = $1 AND enrichment_status = $2
+			ON CONFLICT (user_uuid) DO NOTHING`
+		if _, err = tx.ExecContext(ctx, query, uuid, model.EnrichmentPending); err != nil {
+			return 0, apperror.NewAppError("userRepo.Restore", "failed to enqueue enrichment job", err)
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return 0, apperror.NewAppError("userRepo.Restore", "error commiting transaction", err)
+	}
+
+	log.Info().Int64("affected rows", affected).Msg("user restored in database")
+
+	return affected, nil
+}
 
-	log.Info().Int64("affected rows", affected).Msg("user deleted from database")
+// PurgeDeleted окончательно удаляет не более limit пользователей, мягко удаленных раньше,
+// чем retention назад
+func (r *userRepo) PurgeDeleted(ctx context.Context, retention time.Duration, limit int) (int64, error) {
+	log := zerolog.Ctx(ctx).With().Str("method", "userRepo.PurgeDeleted").Logger()
+
+	query := `
+		DELETE FROM users
+		WHERE uuid IN (
+			SELECT uuid FROM users
+			WHERE deleted_at < NOW() - $1::interval
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)`
+
+	log.Debug().Dur("retention", retention).Int("limit", limit).Msg("executing SQL query to purge deleted users")
+	result, err := r.db.ExecContext(ctx, query, interval(retention), limit)
+	if err != nil {
+		return 0, apperror.NewAppError("userRepo.PurgeDeleted", "failed exec", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, apperror.NewAppError("userRepo.PurgeDeleted", "can't get affectedRows count", err)
+	}
 
 	return affected, nil
 }
+
+// FindHistory возвращает историю изменений пользователя в порядке их применения.
+// История сохраняется и после удаления пользователя
+func (r *userRepo) FindHistory(ctx context.Context, uuid types.UUID) ([]model.UserChange, error) {
+	log := zerolog.Ctx(ctx).With().Str("method", "userRepo.FindHistory").Logger()
+
+	query := `
+		SELECT id, user_uuid, operation, old_values, new_values, request_id, changed_at
+		FROM user_history
+		WHERE user_uuid = $1
+		ORDER BY id`
+
+	log.Debug().Str("uuid", string(uuid)).Msg("executing SQL query to find user history")
+	rows, err := r.db.QueryContext(ctx, query, uuid)
+	if err != nil {
+		return nil, apperror.NewAppError("userRepo.FindHistory", "failed query", err)
+	}
+	defer rows.Close()
+
+	changes := make([]model.UserChange, 0)
+	for rows.Next() {
+		var c model.UserChange
+		var oldValues, newValues []byte
+		if err := rows.Scan(&c.ID, &c.UserUUID, &c.Operation, &oldValues, &newValues, &c.RequestID, &c.ChangedAt); err != nil {
+			return nil, apperror.NewAppError("userRepo.FindHistory", "failed scan", err)
+		}
+		if oldValues != nil {
+			if err := json.Unmarshal(oldValues, &c.Old); err != nil {
+				return nil, apperror.NewAppError("userRepo.FindHistory", "failed to unmarshal old values", err)
+			}
+		}
+		if newValues != nil {
+			if err := json.Unmarshal(newValues, &c.New); err != nil {
+				return nil, apperror.NewAppError("userRepo.FindHistory", "failed to unmarshal new values", err)
+			}
+		}
+		changes = append(changes, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, apperror.NewAppError("userRepo.FindHistory", "rows interation error", err)
+	}
+
+	log.Debug().Str("uuid", string(uuid)).Int("changes", len(changes)).Msg("user history found in database")
+
+	return changes, nil
+}
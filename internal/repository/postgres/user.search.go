@@ -0,0 +1,66 @@
+package postgres
+
+import (
+	"effective-mobile-test-task/internal/types"
+	"strings"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+// maxSearchTerms ограничивает количество слов поискового запроса,
+// чтобы длинная строка не превращалась в тяжелый запрос к БД
+const maxSearchTerms = 5
+
+var (
+	searchColumns = []string{"name", "surname", "patronymic", "name_latin", "surname_latin", "patronymic_latin"}
+	likeEscaper   = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+)
+
+func searchTerms(q types.SearchQuery) []string {
+	terms := strings.Fields(string(q))
+	if len(terms) > maxSearchTerms {
+		terms = terms[:maxSearchTerms]
+	}
+	return terms
+}
+
+// searchCondition подходит под строку, если слово встречается в одном из ФИО-полей
+// как подстрока (ILIKE) или похоже на него по триграммам (pg_trgm)
+func searchCondition(term string) sq.Sqlizer {
+	pattern := "%" + likeEscaper.Replace(term) + "%"
+
+	cond := sq.Or{}
+	for _, col := range searchColumns {
+		cond = append(cond,
+			sq.Expr(col+" ILIKE ?", pattern),
+			sq.Expr(col+" % ?", term),
+		)
+	}
+	return cond
+}
+
+// searchRank возвращает выражение релевантности: совпадение по префиксу дает
+// дополнительный балл, остальное определяется триграммной похожестью
+func searchRank(terms []string) (string, []interface{}) {
+	parts := make([]string, 0, len(terms))
+	args := make([]interface{}, 0, len(terms)*len(searchColumns)*2)
+
+	for _, term := range terms {
+		prefix := likeEscaper.Replace(term) + "%"
+
+		likes := make([]string, 0, len(searchColumns))
+		similarities := make([]string, 0, len(searchColumns))
+		for _, col := range searchColumns {
+			likes = append(likes, col+" ILIKE ?")
+			args = append(args, prefix)
+		}
+		for _, col := range searchColumns {
+			similarities = append(similarities, "similarity(COALESCE("+col+", ''), ?)")
+			args = append(args, term)
+		}
+
+		parts = append(parts, "(CASE WHEN "+strings.Join(likes, " OR ")+" THEN 1 ELSE 0 END + GREATEST("+strings.Join(similarities, ", ")+"))")
+	}
+
+	return "(" + strings.Join(parts, " + ") + ")", args
+}
@@ -0,0 +1,113 @@
+package postgres
+
+import (
+	"context"
+	"effective-mobile-test-task/internal/apperror"
+	"effective-mobile-test-task/internal/model"
+	"effective-mobile-test-task/internal/types"
+
+	"github.com/rs/zerolog"
+)
+
+// NameStatistics собирает статистику имен по неудаленным пользователям, у которых возраст,
+// пол или страна заданы вручную или импортированы. Предсказания в статистику не попадают,
+// иначе офлайн-источник повторял бы сам себя. Имена берутся в транслитерации
+func (r *userRepo) NameStatistics(ctx context.Context) ([]model.NameStats, error) {
+	log := zerolog.Ctx(ctx).With().Str("method", "userRepo.NameStatistics").Logger()
+
+	query := `
+		SELECT GROUPING(gender, country_id), name,
+			AVG(age) FILTER (WHERE age IS NOT NULL AND provenance->'age'->>'kind' IN ($1, $2)),
+			COUNT(*) FILTER (WHERE age IS NOT NULL AND provenance->'age'->>'kind' IN ($1, $2)),
+			gender, COUNT(*) FILTER (WHERE gender IS NOT NULL AND provenance->'gender'->>'kind' IN ($1, $2)),
+			country_id, COUNT(*) FILTER (WHERE country_id IS NOT NULL AND provenance->'country_id'->>'kind' IN ($1, $2))
+		FROM (
+			SELECT COALESCE(name_latin, name) AS name, age, gender, country_id, provenance
+			FROM users
+			WHERE deleted_at IS NULL
+		) u
+		GROUP BY GROUPING SETS ((name), (name, gender), (name, country_id))`
+	args := []interface{}{model.ProvenanceManual, model.ProvenanceImported}
+
+	log.Debug().Interface("args", args).Msg("executing SQL query")
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, apperror.NewAppError("userRepo.NameStatistics", "failed query", err)
+	}
+	defer rows.Close()
+
+	stats := make(map[string]*model.NameStats)
+	order := make([]string, 0)
+	get := func(name string) *model.NameStats {
+		s, ok := stats[name]
+		if !ok {
+			s = &model.NameStats{
+				Name:      name,
+				Genders:   map[types.Gender]float64{},
+				Countries: map[types.CountryID]float64{},
+			}
+			stats[name] = s
+			order = append(order, name)
+		}
+		return s
+	}
+
+	// GROUPING: 3 - итоги по имени, 1 - количество по полу, 2 - количество по стране
+	genderCounts := make(map[string]map[types.Gender]uint)
+	countryCounts := make(map[string]map[types.CountryID]uint)
+	for rows.Next() {
+		var (
+			grouping                            int
+			name                                string
+			meanAge                             *float64
+			ageCount, genderCount, countryCount uint
+			gender                              *types.Gender
+			countryID                           *types.CountryID
+		)
+		if err := rows.Scan(&grouping, &name, &meanAge, &ageCount, &gender, &genderCount, &countryID, &countryCount); err != nil {
+			return nil, apperror.NewAppError("userRepo.NameStatistics", "failed scan", err)
+		}
+		s := get(name)
+		switch grouping {
+		case 1:
+			if gender != nil && genderCount > 0 {
+				if genderCounts[name] == nil {
+					genderCounts[name] = map[types.Gender]uint{}
+				}
+				genderCounts[name][*gender] = genderCount
+			}
+		case 2:
+			if countryID != nil && countryCount > 0 {
+				if countryCounts[name] == nil {
+					countryCounts[name] = map[types.CountryID]uint{}
+				}
+				countryCounts[name][*countryID] = countryCount
+			}
+		default:
+			s.MeanAge, s.AgeCount = meanAge, ageCount
+			s.GenderCount, s.CountryCount = genderCount, countryCount
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, apperror.NewAppError("userRepo.NameStatistics", "rows interation error", err)
+	}
+
+	result := make([]model.NameStats, 0, len(order))
+	for _, name := range order {
+		s := stats[name]
+		for g, n := range genderCounts[name] {
+			s.Genders[g] = float64(n) / float64(s.GenderCount)
+		}
+		for c, n := range countryCounts[name] {
+			s.Countries[c] = float64(n) / float64(s.CountryCount)
+		}
+		if s.MeanAge == nil && len(s.Genders) == 0 && len(s.Countries) == 0 {
+			continue
+		}
+		result = append(result, *s)
+	}
+
+	log.Debug().Int("names", len(result)).Msg("name statistics collected")
+
+	return result, nil
+}
@@ -0,0 +1,11 @@
+package repository
+
+import (
+	"context"
+	"effective-mobile-test-task/internal/model"
+)
+
+type PredictorCacheRepo interface {
+	Get(ctx context.Context, api string, names []string) (map[string]model.PredictionCacheEntry, error)
+	Set(ctx context.Context, entries []model.PredictionCacheEntry) error
+}
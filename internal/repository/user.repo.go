@@ -4,11 +4,20 @@ import (
 	"context"
 	"effective-mobile-test-task/internal/model"
 	"effective-mobile-test-task/internal/types"
+	"time"
 )
 
 type UserRepo interface {
-	Find(ctx context.Context, uqo *model.UserQueryOptions) ([]model.User, int, error)
-	Insert(ctx context.Context, u *model.UserCreate) error
-	Update(ctx context.Context, uuid types.UUID, u *model.UserUpdate) (int64, error)
-	Delete(ctx context.Context, uuid types.UUID) (int64, error)
+	Find(ctx context.Context, uqo *model.UserQueryOptions) (*model.UserPage, error)
+	FindByUUID(ctx context.Context, uuid types.UUID, includeDeleted bool) (*model.User, error)
+	Insert(ctx context.Context, u *model.UserCreate, check model.DuplicateCheck) ([]types.UUID, error)
+	InsertMany(ctx context.Context, users []model.UserCreate, policy string) ([][]types.UUID, error)
+	Update(ctx context.Context, uuid types.UUID, u *model.UserUpdate) (*types.Version, error)
+	ApplyEnrichment(ctx context.Context, uuid types.UUID, e *model.UserEnrichment, final bool) (int64, error)
+	Delete(ctx context.Context, uuid types.UUID, ifVersions []types.Version) (int64, error)
+	Restore(ctx context.Context, uuid types.UUID) (int64, error)
+	PurgeDeleted(ctx context.Context, retention time.Duration, limit int) (int64, error)
+	FindHistory(ctx context.Context, uuid types.UUID) ([]model.UserChange, error)
+	NameStatistics(ctx context.Context) ([]model.NameStats, error)
+	Merge(ctx context.Context, m *model.UserMerge) (*types.Version, error)
 }
@@ -0,0 +1,303 @@
+package service
+
+import (
+	"context"
+	"effective-mobile-test-task/internal/apperror"
+	"effective-mobile-test-task/internal/cache"
+	"effective-mobile-test-task/internal/dto"
+	"effective-mobile-test-task/internal/enricher"
+	"effective-mobile-test-task/internal/httpclient"
+	"effective-mobile-test-task/internal/model"
+	"effective-mobile-test-task/internal/repository"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+type EnrichmentConfig struct {
+	MaxAttempts int
+	RetryDelay  time.Duration
+}
+
+func (c *EnrichmentConfig) Validate() error {
+	if c.MaxAttempts <= 0 {
+		c.MaxAttempts = 5
+	}
+	if c.RetryDelay <= 0 {
+		c.RetryDelay = 30 * time.Second
+	}
+	return nil
+}
+
+type EnrichmentService struct {
+	userRepo repository.UserRepo
+	jobRepo  repository.EnrichmentJobRepo
+	// stages этапы опроса источников, enrichers - все источники в порядке приоритета
+	stages    [][]enricher.Enricher
+	enrichers []enricher.Enricher
+	cfg       EnrichmentConfig
+}
+
+// predictions ответы источников для пакета имен: results[i] - ответы i-го источника по имени.
+// Источник, которого не спрашивали об имени, по нему не отвечает.
+// errs содержит ошибки источников, которые не ответили: если их поля не заполнил другой источник,
+// обогащение нужно повторить
+type predictions struct {
+	results []map[string]*model.UserEnrichment
+	errs    map[string]error
+}
+
+// NewEnrichmentService создает сервис обогащения. Этапы опрашиваются по очереди, источники
+// одного этапа - параллельно. Источник следующего этапа получает только имена, по которым
+// предыдущие этапы не заполнили его поля. Значение поля берется у первого по порядку источника, который его дал
+func NewEnrichmentService(
+	userRepo repository.UserRepo,
+	jobRepo repository.EnrichmentJobRepo,
+	stages [][]enricher.Enricher,
+	cfg EnrichmentConfig) (*EnrichmentService, error) {
+	methodName := "NewEnrichmentService"
+
+	if userRepo == nil {
+		return nil, apperror.NewAppError(methodName, "userRepo is required", nil)
+	}
+	if jobRepo == nil {
+		return nil, apperror.NewAppError(methodName, "jobRepo is required", nil)
+	}
+	var enrichers []enricher.Enricher
+	for _, stage := range stages {
+		if len(stage) == 0 {
+			return nil, apperror.NewAppError(methodName, "enrichment stage can't be empty", nil)
+		}
+		enrichers = append(enrichers, stage...)
+	}
+	if len(enrichers) == 0 {
+		return nil, apperror.NewAppError(methodName, "at least one enricher is required", nil)
+	}
+	seen := make(map[string]struct{}, len(enrichers))
+	for _, en := range enrichers {
+		if en == nil {
+			return nil, apperror.NewAppError(methodName, "enricher can't be nil", nil)
+		}
+		if _, ok := seen[en.Name()]; ok {
+			return nil, apperror.NewAppError(methodName, fmt.Sprintf("enricher %s is registered twice", en.Name()), nil)
+		}
+		seen[en.Name()] = struct{}{}
+		for _, field := range en.Fields() {
+			if !slices.Contains(model.EnrichableFields, field) {
+				return nil, apperror.NewAppError(methodName, fmt.Sprintf("enricher %s declares unsupported field %s", en.Name(), field), nil)
+			}
+		}
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, apperror.NewAppError(methodName, "invalid enrichment config", err)
+	}
+
+	return &EnrichmentService{
+		userRepo:  userRepo,
+		jobRepo:   jobRepo,
+		stages:    stages,
+		enrichers: enrichers,
+		cfg:       cfg,
+	}, nil
+}
+
+// ProcessJobs обогащает пользователей из задач очереди. Имена дедуплицируются,
+// и к каждому источнику уходит один пакетный запрос на группу задач
+func (es *EnrichmentService) ProcessJobs(ctx context.Context, jobs []model.EnrichmentJob) {
+	log := zerolog.Ctx(ctx).With().Str("method", "EnrichmentService.ProcessJobs").Logger()
+
+	groups := map[bool][]model.EnrichmentJob{}
+	for _, job := range jobs {
+		groups[job.BypassCache] = append(groups[job.BypassCache], job)
+	}
+
+	for bypass, group := range groups {
+		groupCtx := ctx
+		if bypass {
+			groupCtx = cache.WithBypass(ctx)
+		}
+
+		names := uniqueNames(group)
+		log.Debug().Int("jobs", len(group)).Int("unique_names", len(names)).Bool("bypass_cache", bypass).Msg("enriching jobs group")
+		p := es.predict(groupCtx, names)
+
+		for i := range group {
+			es.processJob(ctx, &group[i], p)
+		}
+	}
+}
+
+func (es *EnrichmentService) processJob(ctx context.Context, job *model.EnrichmentJob, p *predictions) {
+	log := zerolog.Ctx(ctx).With().Str("method", "EnrichmentService.processJob").Str("uuid", string(job.UserUUID)).Logger()
+
+	e := es.merge(p, string(job.Name), len(es.enrichers))
+	if len(e.Review) > 0 {
+		log.Info().Interface("review", e.Review).Msg("low-confidence predictions left for review")
+	}
+
+	// ошибка источника не требует повтора, если все его поля заполнили другие источники,
+	// например офлайн-статистика при недоступном API
+	// если все оставшиеся ошибки - исчерпанная квота, задача ждет восстановления квоты
+	reasons := make([]string, 0, len(p.errs))
+	var throttledUntil time.Time
+	throttled := true
+	for _, en := range es.enrichers {
+		err, failed := p.errs[en.Name()]
+		if !failed || !slices.ContainsFunc(en.Fields(), func(field string) bool { return !e.HasValue(field) }) {
+			continue
+		}
+		reasons = append(reasons, fmt.Sprintf("%s: %v", en.Name(), err))
+
+		var quotaErr *httpclient.QuotaError
+		if !errors.As(err, &quotaErr) {
+			throttled = false
+			continue
+		}
+		if quotaErr.ResetAt.After(throttledUntil) {
+			throttledUntil = quotaErr.ResetAt
+		}
+	}
+
+	final := len(reasons) == 0
+	if _, err := es.userRepo.ApplyEnrichment(ctx, job.UserUUID, e, final); err != nil {
+		log.Error().Err(err).Msg("failed to save enrichment")
+		return
+	}
+
+	if final {
+		if err := es.jobRepo.Complete(ctx, job.ID); err != nil {
+			log.Error().Err(err).Msg("failed to complete enrichment job")
+			return
+		}
+		log.Info().Msg("user enriched")
+		return
+	}
+
+	reason := strings.Join(reasons, "; ")
+
+	if throttled {
+		// время сброса квоты пришло от API, в БД передается только оставшаяся задержка
+		if err := es.jobRepo.Defer(ctx, job.ID, time.Until(throttledUntil), reason); err != nil {
+			log.Error().Err(err).Msg("failed to defer enrichment job")
+			return
+		}
+		log.Warn().Time("run_at", throttledUntil).Str("reason", reason).Msg("enrichment deferred until API quota reset")
+		return
+	}
+
+	if job.Attempts >= es.cfg.MaxAttempts {
+		if err := es.jobRepo.Fail(ctx, job, reason); err != nil {
+			log.Error().Err(err).Msg("failed to mark enrichment job as failed")
+		}
+		return
+	}
+
+	delay := es.cfg.RetryDelay * time.Duration(job.Attempts*job.Attempts)
+	if err := es.jobRepo.Retry(ctx, job.ID, delay, reason); err != nil {
+		log.Error().Err(err).Msg("failed to reschedule enrichment job")
+		return
+	}
+	log.Warn().Int("attempt", job.Attempts).Dur("delay", delay).Str("reason", reason).Msg("enrichment postponed")
+}
+
+// merge объединяет ответы первых n источников по имени
+func (es *EnrichmentService) merge(p *predictions, name string, n int) *model.UserEnrichment {
+	e := &model.UserEnrichment{Review: map[string]string{}, Provenance: model.Provenance{}}
+	for i, en := range es.enrichers[:n] {
+		if partial := p.results[i][name]; partial != nil {
+			e.Merge(partial, en.Fields())
+		}
+	}
+	return e
+}
+
+func (es *EnrichmentService) predict(ctx context.Context, names []string) *predictions {
+	p := &predictions{
+		results: make([]map[string]*model.UserEnrichment, len(es.enrichers)),
+		errs:    make(map[string]error),
+	}
+
+	offset := 0
+	for _, stage := range es.stages {
+		es.predictStage(ctx, names, stage, offset, p)
+		offset += len(stage)
+	}
+
+	return p
+}
+
+// predictStage опрашивает источники этапа, offset - номер первого из них в es.enrichers
+func (es *EnrichmentService) predictStage(ctx context.Context, names []string, stage []enricher.Enricher, offset int, p *predictions) {
+	log := zerolog.Ctx(ctx).With().Str("method", "EnrichmentService.predictStage").Logger()
+
+	filled := make([]*model.UserEnrichment, len(names))
+	for j, name := range names {
+		filled[j] = es.merge(p, name, offset)
+	}
+	mu := &sync.Mutex{}
+
+	wg := &sync.WaitGroup{}
+	for i, en := range stage {
+		pending := make([]string, 0, len(names))
+		for j, name := range names {
+			if slices.ContainsFunc(en.Fields(), func(field string) bool { return !filled[j].HasValue(field) }) {
+				pending = append(pending, name)
+			}
+		}
+		if len(pending) == 0 {
+			log.Debug().Str("enricher", en.Name()).Msg("fields already filled by previous enrichers, skipping")
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			log.Debug().Str("enricher", en.Name()).Int("names", len(pending)).Msg("calling enricher")
+			res, err := en.Enrich(ctx, pending)
+			if err != nil {
+				log.Warn().Err(err).Msg(fmt.Sprintf("failed to call %s", en.Name()))
+				mu.Lock()
+				p.errs[en.Name()] = err
+				mu.Unlock()
+				return
+			}
+			results := make(map[string]*model.UserEnrichment, len(res))
+			for j, r := range res {
+				results[pending[j]] = r
+			}
+			p.results[offset+i] = results
+		}()
+	}
+	wg.Wait()
+}
+
+func (es *EnrichmentService) RequeueIncomplete(ctx context.Context) (*dto.EnrichmentRequeuePayload, error) {
+	log := zerolog.Ctx(ctx).With().Str("method", "EnrichmentService.RequeueIncomplete").Logger()
+
+	queued, err := es.jobRepo.RequeueIncomplete(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info().Int64("queued", queued).Msg("incomplete users requeued")
+
+	return &dto.EnrichmentRequeuePayload{Queued: queued}, nil
+}
+
+func uniqueNames(jobs []model.EnrichmentJob) []string {
+	names := make([]string, 0, len(jobs))
+	seen := make(map[string]struct{}, len(jobs))
+	for _, job := range jobs {
+		if _, ok := seen[string(job.Name)]; ok {
+			continue
+		}
+		seen[string(job.Name)] = struct{}{}
+		names = append(names, string(job.Name))
+	}
+	return names
+}
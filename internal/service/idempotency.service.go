@@ -0,0 +1,108 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"effective-mobile-test-task/internal/apperror"
+	"effective-mobile-test-task/internal/model"
+	"effective-mobile-test-task/internal/repository"
+	"encoding/hex"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// maxIdempotencyKeyLength совпадает с длиной колонки idempotency_keys.key
+const maxIdempotencyKeyLength = 255
+
+type IdempotencyConfig struct {
+	// TTL время хранения ответа для повторов
+	TTL time.Duration
+	// LockTimeout время, на которое ключ блокируется выполняющимся запросом.
+	// Если сервер упадет, не сохранив ответ, ключ освободится по его истечении
+	LockTimeout time.Duration
+}
+
+func (c *IdempotencyConfig) Validate() error {
+	if c.TTL <= 0 {
+		c.TTL = 24 * time.Hour
+	}
+	if c.LockTimeout <= 0 {
+		c.LockTimeout = time.Minute
+	}
+	return nil
+}
+
+type IdempotencyService struct {
+	repo repository.IdempotencyRepo
+	cfg  IdempotencyConfig
+}
+
+func NewIdempotencyService(repo repository.IdempotencyRepo, cfg IdempotencyConfig) (*IdempotencyService, error) {
+	methodName := "NewIdempotencyService"
+
+	if repo == nil {
+		return nil, apperror.NewAppError(methodName, "idempotencyRepo is required", nil)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, apperror.NewAppError(methodName, "invalid idempotency config", err)
+	}
+
+	return &IdempotencyService{repo: repo, cfg: cfg}, nil
+}
+
+// Begin занимает ключ для запроса request. Возвращает сохраненный ответ, если запрос
+// с этим ключом уже выполнялся, nil - запрос нужно выполнить и передать ответ в Finish.
+// Тот же ключ с другим запросом дает 422, с еще выполняющимся запросом - 409
+func (s *IdempotencyService) Begin(ctx context.Context, scope, key string, request []byte) (*model.IdempotencyRecord, error) {
+	log := zerolog.Ctx(ctx).With().Str("method", "IdempotencyService.Begin").Logger()
+
+	if len(key) > maxIdempotencyKeyLength {
+		return nil, apperror.NewHttpError(400, "Idempotency-Key must not be longer than 255 characters")
+	}
+
+	hash := sha256.Sum256(request)
+	rec := &model.IdempotencyRecord{
+		Scope:       scope,
+		Key:         key,
+		RequestHash: hex.EncodeToString(hash[:]),
+		TTL:         s.cfg.LockTimeout,
+	}
+	existing, err := s.repo.Reserve(ctx, rec)
+	if err != nil {
+		return nil, err
+	}
+	if existing == nil {
+		log.Debug().Str("scope", scope).Str("key", key).Msg("idempotency key reserved")
+		return nil, nil
+	}
+
+	if existing.RequestHash != rec.RequestHash {
+		return nil, apperror.NewHttpErrorWithCode(422, apperror.CodeIdempotencyKeyReused, "Idempotency-Key has already been used with a different request")
+	}
+	if existing.InProgress() {
+		return nil, apperror.NewHttpErrorWithCode(409, apperror.CodeIdempotencyKeyInProgress, "request with this Idempotency-Key is still in progress")
+	}
+
+	log.Info().Str("scope", scope).Str("key", key).Int("status", *existing.StatusCode).Msg("replaying idempotent response")
+
+	return existing, nil
+}
+
+// Finish сохраняет ответ для повторов. Ответы 5xx не сохраняются: ключ освобождается,
+// и клиент может повторить запрос
+func (s *IdempotencyService) Finish(ctx context.Context, scope, key string, statusCode int, response []byte) error {
+	log := zerolog.Ctx(ctx).With().Str("method", "IdempotencyService.Finish").Logger()
+
+	if statusCode >= 500 {
+		log.Debug().Str("key", key).Int("status", statusCode).Msg("releasing idempotency key after server error")
+		return s.repo.Release(ctx, scope, key)
+	}
+
+	return s.repo.Complete(ctx, scope, key, statusCode, response, s.cfg.TTL)
+}
+
+// Release освобождает ключ, если запрос не был выполнен
+func (s *IdempotencyService) Release(ctx context.Context, scope, key string) error {
+	return s.repo.Release(ctx, scope, key)
+}
@@ -3,12 +3,14 @@ package service
 import (
 	"context"
 	"effective-mobile-test-task/internal/apperror"
+	"effective-mobile-test-task/internal/cache"
 	"effective-mobile-test-task/internal/dto"
-	"effective-mobile-test-task/internal/httpclient"
 	"effective-mobile-test-task/internal/model"
+	"effective-mobile-test-task/internal/normalize"
 	"effective-mobile-test-task/internal/repository"
 	"effective-mobile-test-task/internal/types"
-	"sync"
+	"effective-mobile-test-task/internal/validation"
+	"slices"
 	"time"
 
 	"github.com/google/uuid"
@@ -16,195 +18,520 @@ import (
 )
 
 type UserService struct {
-	userRepo          repository.UserRepo
-	agifyClient       *httpclient.PredictorClient[httpclient.AgifyResponse]
-	genderizeClient   *httpclient.PredictorClient[httpclient.GenderizeResponse]
-	nationalizeClient *httpclient.PredictorClient[httpclient.NationalizeResponse]
+	userRepo repository.UserRepo
 }
 
-func NewUserService(
-	userRepo repository.UserRepo,
-	agifyClient *httpclient.PredictorClient[httpclient.AgifyResponse],
-	genderizeClient *httpclient.PredictorClient[httpclient.GenderizeResponse],
-	nationalizeClient *httpclient.PredictorClient[httpclient.NationalizeResponse]) (*UserService, error) {
+func NewUserService(userRepo repository.UserRepo) (*UserService, error) {
 	methodName := "NewUserService"
 
 	if userRepo == nil {
 		return nil, apperror.NewAppError(methodName, "userRepo is required", nil)
 	}
-	if agifyClient == nil {
-		return nil, apperror.NewAppError(methodName, "agifyClient is required", nil)
-	}
-	if genderizeClient == nil {
-		return nil, apperror.NewAppError(methodName, "genderizeClient is required", nil)
-	}
-	if nationalizeClient == nil {
-		return nil, apperror.NewAppError(methodName, "nationalizeClient is required", nil)
-	}
 
-	return &UserService{
-		userRepo:          userRepo,
-		agifyClient:       agifyClient,
-		genderizeClient:   genderizeClient,
-		nationalizeClient: nationalizeClient,
-	}, nil
+	return &UserService{userRepo: userRepo}, nil
 }
 
 func (us *UserService) FindUsers(ctx context.Context, uqo *model.UserQueryOptions) (*dto.ListOfUsersPayload, error) {
 	log := zerolog.Ctx(ctx).With().Str("method", "UserService.FindUsers").Logger()
 
 	log.Debug().Interface("userQueryOptions", uqo).Msg("extracting users with filters from database")
-	users, total, err := us.userRepo.Find(ctx, uqo)
+	page, err := us.userRepo.Find(ctx, uqo)
 	if err != nil {
 		return nil, err
 	}
 
 	log.Debug().Msg("converting []models.User list to []dto.UserResponseDTO")
 	usersDTO := []dto.UserPayload{}
-	for _, u := range users {
-		usersDTO = append(usersDTO, dto.UserPayload{
-			UUID:       u.UUID,
-			Name:       u.Name,
-			Surname:    u.Surname,
-			Patronymic: u.Patronymic,
-			Age:        u.Age,
-			Gender:     u.Gender,
-			CountryID:  u.CountryID,
-			CreatedAt:  u.CreatedAt.Format(time.RFC3339),
-		})
+	for _, u := range page.Users {
+		usersDTO = append(usersDTO, toUserPayload(&u))
 	}
 
-	log.Info().Int("total", total).Int("on_page", len(usersDTO)).Msg("users found in service")
+	log.Info().Interface("total", page.Total).Int("on_page", len(usersDTO)).Msg("users found in service")
 
 	return &dto.ListOfUsersPayload{
-		Total: total,
-		Users: usersDTO,
+		Total:      page.Total,
+		NextCursor: page.NextCursor,
+		Users:      usersDTO,
 	}, nil
 }
 
-func (us *UserService) CreateUser(ctx context.Context, uDTO *dto.UserCreateDTO) (types.UUID, error) {
+func (us *UserService) GetUser(ctx context.Context, uuid types.UUID) (*dto.UserPayload, error) {
+	log := zerolog.Ctx(ctx).With().Str("method", "UserService.GetUser").Logger()
+
+	log.Debug().Str("uuid", string(uuid)).Msg("extracting user from database")
+	u, err := us.userRepo.FindByUUID(ctx, uuid, false)
+	if err != nil {
+		return nil, err
+	}
+	if u == nil {
+		return nil, apperror.NewHttpError(404, "user not found")
+	}
+
+	payload := toUserPayload(u)
+	log.Info().Str("uuid", string(uuid)).Msg("user found in service")
+
+	return &payload, nil
+}
+
+func (us *UserService) GetUserHistory(ctx context.Context, uuid types.UUID) (*dto.UserHistoryPayload, error) {
+	log := zerolog.Ctx(ctx).With().Str("method", "UserService.GetUserHistory").Logger()
+
+	log.Debug().Str("uuid", string(uuid)).Msg("extracting user history from database")
+	changes, err := us.userRepo.FindHistory(ctx, uuid)
+	if err != nil {
+		return nil, err
+	}
+	// у пользователей, созданных до появления истории, изменений может не быть
+	if len(changes) == 0 {
+		u, err := us.userRepo.FindByUUID(ctx, uuid, true)
+		if err != nil {
+			return nil, err
+		}
+		if u == nil {
+			return nil, apperror.NewHttpError(404, "user not found")
+		}
+	}
+
+	payload := &dto.UserHistoryPayload{Changes: make([]dto.UserChangePayload, 0, len(changes))}
+	for _, c := range changes {
+		payload.Changes = append(payload.Changes, dto.UserChangePayload{
+			ID:        c.ID,
+			Operation: c.Operation,
+			Old:       c.Old,
+			New:       c.New,
+			RequestID: c.RequestID,
+			ChangedAt: c.ChangedAt.Format(time.RFC3339),
+		})
+	}
+	log.Info().Str("uuid", string(uuid)).Int("changes", len(changes)).Msg("user history found in service")
+
+	return payload, nil
+}
+
+// CreateUser создает пользователя, если среди существующих нет пользователя с тем же ФИО.
+// При найденном дубликате возвращает 409 с existing_uuid либо, при политике DuplicateLink,
+// создает пользователя со ссылкой на дубликат
+func (us *UserService) CreateUser(ctx context.Context, uDTO *dto.UserCreateDTO, check model.DuplicateCheck) (*dto.UserCreatePayload, error) {
 	log := zerolog.Ctx(ctx).With().Str("method", "UserService.CreateUser").Logger()
 	log.Debug().Interface("userDTO", uDTO).Msg("received update user request")
 
+	uDTO.Normalize()
+	if err := uDTO.Validate(); err != nil {
+		return nil, validation.HttpError(err)
+	}
+	latin := latinNames(uDTO.Name, uDTO.Surname, uDTO.Patronymic)
+
 	uuid, err := uuid.NewRandom()
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	uuidStr := uuid.String()
 	log.Debug().Str("uuid", uuidStr).Msg("generated uuid")
 
 	u := &model.UserCreate{
-		UUID:       types.UUID(uuidStr),
-		Name:       uDTO.Name,
-		Surname:    uDTO.Surname,
-		Patronymic: uDTO.Patronymic,
+		UUID:        types.UUID(uuidStr),
+		Name:        uDTO.Name,
+		Surname:     uDTO.Surname,
+		Patronymic:  uDTO.Patronymic,
+		LatinNames:  latin,
+		Age:         uDTO.Age,
+		Gender:      uDTO.Gender,
+		CountryID:   uDTO.CountryID,
+		Provenance:  importedProvenance(uDTO),
+		BypassCache: cache.IsBypassed(ctx),
 	}
 	log.Debug().Str("uuid", uuidStr).Interface("user", u).Msg("converted DTO into model")
 
-	nameStr := string(u.Name)
-	wg := &sync.WaitGroup{}
-	mu := &sync.Mutex{}
-	wg.Add(3)
-	go func() {
-		defer wg.Done()
-		log.Debug().Str("uuid", uuidStr).Str("name", nameStr).Msg("calling agify API")
-		res, err := us.agifyClient.Predict(ctx, nameStr)
-		if err != nil {
-			log.Warn().Str("uuid", uuidStr).Str("name", nameStr).Err(err).Msg("failed to call agify")
-			return
-		}
+	log.Debug().Str("uuid", uuidStr).Bool("fuzzy", check.Fuzzy).Msg("inserting user into database and enqueueing enrichment")
+	duplicates, err := us.userRepo.Insert(ctx, u, check)
+	if err != nil {
+		return nil, err
+	}
+	if len(duplicates) > 0 && check.Policy != model.DuplicateLink {
+		log.Info().Str("existing_uuid", string(duplicates[0])).Msg("user already exists")
+		return nil, apperror.NewHttpErrorWithCode(409, apperror.CodeDuplicate, "user with the same name already exists").
+			WithMeta("existing_uuid", duplicates[0]).
+			WithMeta("duplicates", duplicates)
+	}
 
-		mu.Lock()
-		u.Age = (*types.Age)(&res.Age)
-		mu.Unlock()
-	}()
-	go func() {
-		defer wg.Done()
-		log.Debug().Str("uuid", uuidStr).Str("name", nameStr).Msg("calling genderize API")
-		res, err := us.genderizeClient.Predict(ctx, nameStr)
-		if err != nil {
-			log.Warn().Str("uuid", uuidStr).Str("name", nameStr).Err(err).Msg("failed to call genderize")
-			return
+	log.Info().Str("uuid", uuidStr).Interface("duplicate_of", u.DuplicateOf).Msg("user successfully created")
+
+	return &dto.UserCreatePayload{UUID: u.UUID, DuplicateOf: u.DuplicateOf}, nil
+}
+
+// CreateUsers создает пользователей пакетом. Пользователи с ошибками валидации и, при политике
+// DuplicateReject, точные дубликаты существующих или предыдущих в пакете пользователей не создаются
+func (us *UserService) CreateUsers(ctx context.Context, uDTOs []dto.UserCreateDTO, policy string) (*dto.UserBatchCreatePayload, error) {
+	log := zerolog.Ctx(ctx).With().Str("method", "UserService.CreateUsers").Logger()
+	log.Debug().Int("count", len(uDTOs)).Msg("received batch create users request")
+
+	result := &dto.UserBatchCreatePayload{Results: make([]dto.UserBatchItemPayload, len(uDTOs))}
+	users := make([]model.UserCreate, 0, len(uDTOs))
+	indexes := make([]int, 0, len(uDTOs))
+	bypassCache := cache.IsBypassed(ctx)
+
+	for i, uDTO := range uDTOs {
+		result.Results[i].Index = i
+		uDTO.Normalize()
+		if err := uDTO.Validate(); err != nil {
+			msg := err.Error()
+			result.Results[i].Error = &msg
+			result.Results[i].Details = errorDetails(err)
+			result.Failed++
+			continue
 		}
 
-		mu.Lock()
-		u.Gender = (*types.Gender)(&res.Gender)
-		mu.Unlock()
-	}()
-	go func() {
-		defer wg.Done()
-		log.Debug().Str("uuid", uuidStr).Str("name", nameStr).Msg("calling nationalize API")
-		res, err := us.nationalizeClient.Predict(ctx, nameStr)
+		uuid, err := uuid.NewRandom()
 		if err != nil {
-			log.Warn().Str("uuid", uuidStr).Str("name", nameStr).Err(err).Msg("failed to call nationalize")
-			return
+			return nil, err
 		}
-		if len(res.Countries) == 0 {
-			log.Warn().Str("uuid", uuidStr).Str("name", nameStr).Msg("propability country list is empty")
-			return
+		u := model.UserCreate{
+			UUID:        types.UUID(uuid.String()),
+			Name:        uDTO.Name,
+			Surname:     uDTO.Surname,
+			Patronymic:  uDTO.Patronymic,
+			LatinNames:  latinNames(uDTO.Name, uDTO.Surname, uDTO.Patronymic),
+			Age:         uDTO.Age,
+			Gender:      uDTO.Gender,
+			CountryID:   uDTO.CountryID,
+			Provenance:  importedProvenance(&uDTO),
+			BypassCache: bypassCache,
 		}
+		users = append(users, u)
+		indexes = append(indexes, i)
+	}
 
-		mu.Lock()
-		u.CountryID = (*types.CountryID)(&res.Countries[0].CountryId)
-		mu.Unlock()
-	}()
-
-	wg.Wait()
-
-	log.Debug().Str("uuid", uuidStr).Interface("user", u).Msg("enhanced model and inserting user into database")
-	err = us.userRepo.Insert(ctx, u)
+	log.Debug().Int("count", len(users)).Str("on_duplicate", policy).Msg("inserting users into database and enqueueing enrichment")
+	duplicates, err := us.userRepo.InsertMany(ctx, users, policy)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	for j, i := range indexes {
+		item := &result.Results[i]
+		if len(duplicates[j]) > 0 && policy != model.DuplicateLink {
+			msg := "user with the same name already exists"
+			item.Error = &msg
+			item.ExistingUUID = &duplicates[j][0]
+			result.Failed++
+			continue
+		}
+		item.UUID = &users[j].UUID
+		item.DuplicateOf = users[j].DuplicateOf
+		result.Created++
 	}
 
-	log.Info().Str("uuid", uuidStr).Msg("user successfully created")
+	log.Info().Int("created", result.Created).Int("failed", result.Failed).Msg("users batch successfully created")
 
-	return u.UUID, nil
+	return result, nil
 }
 
-func (us *UserService) UpdateUser(ctx context.Context, uuid types.UUID, uDTO *dto.UserUpdateDTO) error {
+// UpdateUser применяет JSON Merge Patch к пользователю и возвращает его новую версию.
+// ifMatch - ожидаемые версии из If-Match, nil - без проверки
+func (us *UserService) UpdateUser(ctx context.Context, uuid types.UUID, uDTO *dto.UserUpdateDTO, ifMatch []types.Version) (types.Version, error) {
 	log := zerolog.Ctx(ctx).With().Str("method", "UserService.UpdateUser").Logger()
 
 	log.Debug().Str("uuid", string(uuid)).Interface("userDTO", uDTO).Msg("received update user request")
+	uDTO.Normalize()
+	if err := uDTO.Validate(); err != nil {
+		return 0, validation.HttpError(err)
+	}
+
 	u := &model.UserUpdate{
-		Name:       uDTO.Name,
-		Surname:    uDTO.Surname,
+		Name:       uDTO.Name.Value,
+		Surname:    uDTO.Surname.Value,
 		Patronymic: uDTO.Patronymic,
 		Age:        uDTO.Age,
 		Gender:     uDTO.Gender,
 		CountryID:  uDTO.CountryID,
+		IfVersions: ifMatch,
+	}
+
+	return us.update(ctx, uuid, u)
+}
+
+// ReplaceUser заменяет все изменяемые поля пользователя и возвращает его новую версию.
+// ifMatch - ожидаемые версии из If-Match, nil - без проверки
+func (us *UserService) ReplaceUser(ctx context.Context, uuid types.UUID, uDTO *dto.UserReplaceDTO, ifMatch []types.Version) (types.Version, error) {
+	log := zerolog.Ctx(ctx).With().Str("method", "UserService.ReplaceUser").Logger()
+
+	log.Debug().Str("uuid", string(uuid)).Interface("userDTO", uDTO).Msg("received replace user request")
+	uDTO.Normalize()
+	if err := uDTO.Validate(); err != nil {
+		return 0, validation.HttpError(err)
+	}
+
+	u := &model.UserUpdate{
+		Name:       &uDTO.Name,
+		Surname:    &uDTO.Surname,
+		Patronymic: types.NewNullable(uDTO.Patronymic),
+		Age:        types.NewNullable(uDTO.Age),
+		Gender:     types.NewNullable(uDTO.Gender),
+		CountryID:  types.NewNullable(uDTO.CountryID),
+		IfVersions: ifMatch,
+	}
+
+	return us.update(ctx, uuid, u)
+}
+
+// importedProvenance помечает переданные при создании age, gender и country_id как импортированные:
+// обогащение их не перезаписывает
+func importedProvenance(uDTO *dto.UserCreateDTO) model.Provenance {
+	provenance := model.Provenance{}
+	imported := model.FieldProvenance{Kind: model.ProvenanceImported, Source: model.ProvenanceSourceImport, SetAt: time.Now().UTC()}
+	if uDTO.Age != nil {
+		provenance[model.Age] = imported
+	}
+	if uDTO.Gender != nil {
+		provenance[model.Gender] = imported
+	}
+	if uDTO.CountryID != nil {
+		provenance[model.CountryId] = imported
+	}
+	return provenance
+}
+
+// update записывает изменения пользователя вместе с транслитерацией ФИО. Переданные age, gender
+// и country_id, в том числе очищенные, помечаются как заданные вручную и больше не перезаписываются обогащением
+func (us *UserService) update(ctx context.Context, uuid types.UUID, u *model.UserUpdate) (types.Version, error) {
+	log := zerolog.Ctx(ctx).With().Str("method", "UserService.update").Logger()
+
+	if u.Name != nil {
+		latin := types.Name(normalize.Transliterate(string(*u.Name)))
+		u.NameLatin = &latin
+	}
+	if u.Surname != nil {
+		latin := types.Surname(normalize.Transliterate(string(*u.Surname)))
+		u.SurnameLatin = &latin
+	}
+	if u.Patronymic.Set {
+		u.PatronymicLatin = types.NewNullable(transliteratePatronymic(u.Patronymic.Value))
+	}
+
+	u.Provenance = model.Provenance{}
+	manual := model.FieldProvenance{Kind: model.ProvenanceManual, Source: model.ProvenanceSourceAPI, SetAt: time.Now().UTC()}
+	if u.Age.Set {
+		u.Provenance[model.Age] = manual
+	}
+	if u.Gender.Set {
+		u.Provenance[model.Gender] = manual
+	}
+	if u.CountryID.Set {
+		u.Provenance[model.CountryId] = manual
 	}
 	log.Debug().Str("uuid", string(uuid)).Interface("user", u).Msg("converted dto to model")
 
-	affected, err := us.userRepo.Update(ctx, uuid, u)
+	version, err := us.userRepo.Update(ctx, uuid, u)
+	if err != nil {
+		return 0, err
+	}
+
+	log.Debug().Str("uuid", string(uuid)).Interface("version", version).Msg("received response from db")
+	if version == nil {
+		return 0, us.notUpdatedError(ctx, uuid, u.IfVersions)
+	}
+
+	log.Info().Str("uuid", string(uuid)).Int64("version", int64(*version)).Msg("user updated succesfully")
+	return *version, nil
+}
+
+// DeleteUser удаляет пользователя. ifMatch - ожидаемые версии из If-Match, nil - без проверки
+func (us *UserService) DeleteUser(ctx context.Context, uuid types.UUID, ifMatch []types.Version) error {
+	log := zerolog.Ctx(ctx).With().Str("method", "UserService.DeleteUser").Logger()
+
+	log.Debug().Str("uuid", string(uuid)).Msg("received delete user request")
+
+	affected, err := us.userRepo.Delete(ctx, uuid, ifMatch)
 	if err != nil {
 		return err
 	}
 
 	log.Debug().Str("uuid", string(uuid)).Int64("affected", affected).Msg("received response from db")
 	if affected == 0 {
-		return apperror.NewHttpError(404, "user not found")
+		return us.notUpdatedError(ctx, uuid, ifMatch)
 	}
 
-	log.Info().Str("uuid", string(uuid)).Msg("user updated succesfully")
+	log.Info().Str("uuid", string(uuid)).Msg("user deleted succesfully")
 	return nil
 }
 
-func (us *UserService) DeleteUser(ctx context.Context, uuid types.UUID) error {
-	log := zerolog.Ctx(ctx).With().Str("method", "UserService.DeleteUser").Logger()
+func (us *UserService) RestoreUser(ctx context.Context, uuid types.UUID) error {
+	log := zerolog.Ctx(ctx).With().Str("method", "UserService.RestoreUser").Logger()
 
-	log.Debug().Str("uuid", string(uuid)).Msg("received delete user request")
+	log.Debug().Str("uuid", string(uuid)).Msg("received restore user request")
 
-	affected, err := us.userRepo.Delete(ctx, uuid)
+	affected, err := us.userRepo.Restore(ctx, uuid)
 	if err != nil {
 		return err
 	}
 
 	log.Debug().Str("uuid", string(uuid)).Int64("affected", affected).Msg("received response from db")
 	if affected == 0 {
-		return apperror.NewHttpError(404, "user not found")
+		return apperror.NewHttpError(404, "deleted user not found")
 	}
 
-	log.Info().Str("uuid", string(uuid)).Msg("user deleted succesfully")
+	log.Info().Str("uuid", string(uuid)).Msg("user restored succesfully")
 	return nil
 }
+
+// MergeUsers вливает пользователя source_uuid в пользователя uuid и возвращает результат.
+// Поля переносятся по правилам mDTO.Prefer, source удаляется и ссылается на uuid.
+// ifMatch - ожидаемые версии uuid из If-Match, nil - без проверки
+func (us *UserService) MergeUsers(ctx context.Context, uuid types.UUID, mDTO *dto.UserMergeDTO, ifMatch []types.Version) (*dto.UserPayload, error) {
+	log := zerolog.Ctx(ctx).With().Str("method", "UserService.MergeUsers").Logger()
+
+	log.Debug().Str("uuid", string(uuid)).Interface("mergeDTO", mDTO).Msg("received merge users request")
+	if err := mDTO.Validate(uuid); err != nil {
+		return nil, validation.HttpError(err)
+	}
+
+	target, err := us.userRepo.FindByUUID(ctx, uuid, false)
+	if err != nil {
+		return nil, err
+	}
+	if target == nil {
+		return nil, apperror.NewHttpError(404, "user not found")
+	}
+	if ifMatch != nil && !slices.Contains(ifMatch, target.Version) {
+		return nil, apperror.NewHttpErrorWithCode(412, apperror.CodeVersionMismatch, "user has been modified, current version does not match If-Match")
+	}
+	source, err := us.userRepo.FindByUUID(ctx, mDTO.SourceUUID, false)
+	if err != nil {
+		return nil, err
+	}
+	if source == nil {
+		return nil, apperror.NewHttpError(404, "source user not found")
+	}
+
+	m := &model.UserMerge{
+		TargetUUID:    target.UUID,
+		SourceUUID:    source.UUID,
+		Fields:        []string{},
+		TargetVersion: target.Version,
+		SourceVersion: source.Version,
+	}
+	for _, field := range model.MergeableFields {
+		switch mDTO.Prefer[field] {
+		case model.MergeSource:
+			m.Fields = append(m.Fields, field)
+		case "":
+			if !target.HasValue(field) && source.HasValue(field) {
+				m.Fields = append(m.Fields, field)
+			}
+		}
+	}
+	log.Debug().Interface("merge", m).Msg("merging users")
+
+	version, err := us.userRepo.Merge(ctx, m)
+	if err != nil {
+		return nil, err
+	}
+	if version == nil {
+		if ifMatch != nil {
+			return nil, us.notUpdatedError(ctx, uuid, ifMatch)
+		}
+		return nil, apperror.NewHttpErrorWithCode(409, apperror.CodeConflict, "users have been modified during merge, retry the request")
+	}
+
+	merged, err := us.userRepo.FindByUUID(ctx, uuid, false)
+	if err != nil {
+		return nil, err
+	}
+	if merged == nil {
+		return nil, apperror.NewHttpError(404, "user not found")
+	}
+
+	payload := toUserPayload(merged)
+	log.Info().Str("uuid", string(uuid)).Str("source", string(source.UUID)).Strs("fields", m.Fields).
+		Int64("version", int64(*version)).Msg("users merged successfully")
+
+	return &payload, nil
+}
+
+// notUpdatedError определяет, почему изменение не затронуло ни одной строки:
+// пользователь не найден (404) или его версия не совпала с If-Match (412)
+func (us *UserService) notUpdatedError(ctx context.Context, uuid types.UUID, ifMatch []types.Version) error {
+	if ifMatch == nil {
+		return apperror.NewHttpError(404, "user not found")
+	}
+	u, err := us.userRepo.FindByUUID(ctx, uuid, false)
+	if err != nil {
+		return err
+	}
+	if u == nil {
+		return apperror.NewHttpError(404, "user not found")
+	}
+	return apperror.NewHttpErrorWithCode(412, apperror.CodeVersionMismatch, "user has been modified, current version does not match If-Match")
+}
+
+func toUserPayload(u *model.User) dto.UserPayload {
+	payload := dto.UserPayload{
+		UUID:               u.UUID,
+		Name:               u.Name,
+		Surname:            u.Surname,
+		Patronymic:         u.Patronymic,
+		NameLatin:          u.NameLatin,
+		SurnameLatin:       u.SurnameLatin,
+		PatronymicLatin:    u.PatronymicLatin,
+		Age:                u.Age,
+		Gender:             u.Gender,
+		CountryID:          u.CountryID,
+		EnrichmentStatus:   u.EnrichmentStatus,
+		DuplicateOf:        u.DuplicateOf,
+		Version:            u.Version,
+		AgeCount:           u.AgeCount,
+		GenderProbability:  u.GenderProbability,
+		GenderCount:        u.GenderCount,
+		CountryProbability: u.CountryProbability,
+		CountryCount:       u.CountryCount,
+		ReviewReasons:      u.ReviewReasons,
+		CreatedAt:          u.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:          u.UpdatedAt.Format(time.RFC3339),
+	}
+	if u.DeletedAt != nil {
+		deletedAt := u.DeletedAt.Format(time.RFC3339)
+		payload.DeletedAt = &deletedAt
+	}
+	if len(u.Provenance) > 0 {
+		payload.Provenance = make(map[string]dto.FieldProvenancePayload, len(u.Provenance))
+		for field, p := range u.Provenance {
+			payload.Provenance[field] = dto.FieldProvenancePayload{
+				Kind:   p.Kind,
+				Source: p.Source,
+				SetAt:  p.SetAt.Format(time.RFC3339),
+			}
+		}
+	}
+	for _, c := range u.Countries {
+		payload.Countries = append(payload.Countries, dto.CountryProbabilityPayload{
+			CountryID:   c.CountryID,
+			Probability: c.Probability,
+		})
+	}
+	return payload
+}
+
+// latinNames транслитерирует ФИО для запросов к API предсказаний и поиска
+func latinNames(name types.Name, surname types.Surname, patronymic *types.Patronymic) model.LatinNames {
+	return model.LatinNames{
+		NameLatin:       types.Name(normalize.Transliterate(string(name))),
+		SurnameLatin:    types.Surname(normalize.Transliterate(string(surname))),
+		PatronymicLatin: transliteratePatronymic(patronymic),
+	}
+}
+
+func transliteratePatronymic(p *types.Patronymic) *types.Patronymic {
+	if p == nil {
+		return nil
+	}
+	latin := types.Patronymic(normalize.Transliterate(string(*p)))
+	return &latin
+}
+
+// errorDetails ошибки полей для результата пакетной операции
+func errorDetails(err error) []dto.ErrorDetailPayload {
+	details := []dto.ErrorDetailPayload{}
+	for _, d := range validation.HttpError(err).Details {
+		details = append(details, dto.ErrorDetailPayload{Field: d.Field, Code: d.Code, Message: d.Message})
+	}
+	return details
+}
@@ -0,0 +1,39 @@
+package types
+
+import "encoding/json"
+
+// Nullable значение, различающее отсутствие поля и явный null (JSON Merge Patch, RFC 7396).
+// Set - поле передано, Value == nil при Set - поле нужно очистить
+type Nullable[T any] struct {
+	Set   bool
+	Value *T
+}
+
+// NewNullable заданное значение, nil - явный null
+func NewNullable[T any](value *T) Nullable[T] {
+	return Nullable[T]{Set: true, Value: value}
+}
+
+func (n *Nullable[T]) UnmarshalJSON(data []byte) error {
+	n.Set = true
+	if string(data) == "null" {
+		n.Value = nil
+		return nil
+	}
+
+	var value T
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	n.Value = &value
+	return nil
+}
+
+func (n Nullable[T]) MarshalJSON() ([]byte, error) {
+	return json.Marshal(n.Value)
+}
+
+// IsNull поле передано со значением null
+func (n Nullable[T]) IsNull() bool {
+	return n.Set && n.Value == nil
+}
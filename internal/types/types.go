@@ -1,15 +1,21 @@
 package types
 
 type (
-	UUID       string
-	Name       string
-	Surname    string
-	Patronymic string
-	Age        uint64
-	Gender     string
-	CountryID  string
-	Page       uint64
-	Limit      uint64
-	OrderBy    string
-	OrderDir   string
+	UUID             string
+	Name             string
+	Surname          string
+	Patronymic       string
+	Age              uint64
+	Gender           string
+	CountryID        string
+	Page             uint64
+	Limit            uint64
+	OrderBy          string
+	OrderDir         string
+	SearchQuery      string
+	Cursor           string
+	EnrichmentStatus string
+	Probability      float64
+	SampleCount      uint64
+	Version          int64
 )
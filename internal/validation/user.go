@@ -0,0 +1,48 @@
+package validation
+
+import (
+	"fmt"
+	"regexp"
+	"unicode/utf8"
+)
+
+const (
+	// MaxNameLength соответствует VARCHAR(255) колонок name, surname и patronymic
+	MaxNameLength = 255
+	MaxAge        = 150
+)
+
+// namePattern буквы латиницы и кириллицы, части двойного имени разделяются дефисом
+var namePattern = regexp.MustCompile(`^[\p{Latin}\p{Cyrillic}]+(-[\p{Latin}\p{Cyrillic}]+)*$`)
+
+var genders = map[string]struct{}{
+	"male":   {},
+	"female": {},
+}
+
+// Name проверяет имя, фамилию или отчество
+func (v *Validator) Name(field, value string) {
+	switch {
+	case value == "":
+		v.Add(field, CodeRequired, "must not be empty")
+	case utf8.RuneCountInString(value) > MaxNameLength:
+		v.Add(field, CodeTooLong, fmt.Sprintf("must be at most %d characters", MaxNameLength))
+	case !namePattern.MatchString(value):
+		v.Add(field, CodeInvalidCharacters, "must contain only Latin or Cyrillic letters and hyphens between parts")
+	}
+}
+
+func (v *Validator) Age(field string, value uint64) {
+	v.Check(value <= MaxAge, field, CodeOutOfRange, fmt.Sprintf("must be between 0 and %d", MaxAge))
+}
+
+func (v *Validator) Gender(field, value string) {
+	_, ok := genders[value]
+	v.Check(ok, field, CodeInvalidValue, "must be one of: male, female")
+}
+
+// CountryID проверяет код страны по ISO 3166-1 alpha-2
+func (v *Validator) CountryID(field, value string) {
+	_, ok := countries[value]
+	v.Check(ok, field, CodeInvalidValue, "must be an ISO 3166-1 alpha-2 country code")
+}
@@ -0,0 +1,79 @@
+package validation
+
+import (
+	"effective-mobile-test-task/internal/apperror"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Коды ошибок валидации полей
+const (
+	CodeRequired          = "required"
+	CodeNotNull           = "not_null"
+	CodeTooLong           = "too_long"
+	CodeInvalidCharacters = "invalid_characters"
+	CodeOutOfRange        = "out_of_range"
+	CodeInvalidValue      = "invalid_value"
+)
+
+type (
+	// FieldError ошибка валидации одного поля
+	FieldError struct {
+		Field   string
+		Code    string
+		Message string
+	}
+	// Errors ошибки валидации всех полей запроса
+	Errors []FieldError
+	// Validator собирает ошибки по всем полям, чтобы вернуть их одним ответом
+	Validator struct {
+		errs Errors
+	}
+)
+
+func (e Errors) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, fe := range e {
+		messages = append(messages, fmt.Sprintf("%s: %s", fe.Field, fe.Message))
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Add добавляет ошибку поля
+func (v *Validator) Add(field, code, message string) {
+	v.errs = append(v.errs, FieldError{Field: field, Code: code, Message: message})
+}
+
+// Check добавляет ошибку поля, если ok ложно
+func (v *Validator) Check(ok bool, field, code, message string) {
+	if !ok {
+		v.Add(field, code, message)
+	}
+}
+
+// Err возвращает накопленные ошибки или nil
+func (v *Validator) Err() error {
+	if len(v.errs) == 0 {
+		return nil
+	}
+	return v.errs
+}
+
+// Details ошибки в формате деталей ответа API
+func (e Errors) Details() []apperror.ErrorDetail {
+	details := make([]apperror.ErrorDetail, 0, len(e))
+	for _, fe := range e {
+		details = append(details, apperror.ErrorDetail{Field: fe.Field, Code: fe.Code, Message: fe.Message})
+	}
+	return details
+}
+
+// HttpError преобразует ошибку валидации в ответ 400 со списком ошибок по полям
+func HttpError(err error) *apperror.HttpError {
+	var errs Errors
+	if errors.As(err, &errs) {
+		return apperror.NewValidationError(errs.Details())
+	}
+	return apperror.NewHttpError(400, err.Error())
+}
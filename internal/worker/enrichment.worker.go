@@ -0,0 +1,116 @@
+package worker
+
+import (
+	"context"
+	"effective-mobile-test-task/internal/apperror"
+	"effective-mobile-test-task/internal/repository"
+	"effective-mobile-test-task/internal/service"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+type EnrichmentWorkerConfig struct {
+	Workers      int
+	BatchSize    int
+	PollInterval time.Duration
+	// Lease время, на которое задача скрывается от других воркеров после захвата
+	Lease time.Duration
+}
+
+func (c *EnrichmentWorkerConfig) Validate() error {
+	if c.Workers <= 0 {
+		c.Workers = 1
+	}
+	if c.BatchSize <= 0 {
+		c.BatchSize = 100
+	}
+	if c.PollInterval <= 0 {
+		c.PollInterval = time.Second
+	}
+	if c.Lease <= 0 {
+		c.Lease = 5 * time.Minute
+	}
+	if c.Lease < c.PollInterval {
+		return fmt.Errorf("lease must be greater than poll interval")
+	}
+	return nil
+}
+
+// EnrichmentWorker разбирает очередь enrichment_jobs и передает задачи в EnrichmentService
+type EnrichmentWorker struct {
+	cfg       EnrichmentWorkerConfig
+	jobRepo   repository.EnrichmentJobRepo
+	enrichSvc *service.EnrichmentService
+	logger    zerolog.Logger
+	wg        sync.WaitGroup
+}
+
+func NewEnrichmentWorker(
+	cfg EnrichmentWorkerConfig,
+	jobRepo repository.EnrichmentJobRepo,
+	enrichSvc *service.EnrichmentService,
+	logger zerolog.Logger) (*EnrichmentWorker, error) {
+	methodName := "NewEnrichmentWorker"
+
+	if err := cfg.Validate(); err != nil {
+		return nil, apperror.NewAppError(methodName, "invalid worker config", err)
+	}
+	if jobRepo == nil {
+		return nil, apperror.NewAppError(methodName, "jobRepo is required", nil)
+	}
+	if enrichSvc == nil {
+		return nil, apperror.NewAppError(methodName, "enrichSvc is required", nil)
+	}
+
+	return &EnrichmentWorker{
+		cfg:       cfg,
+		jobRepo:   jobRepo,
+		enrichSvc: enrichSvc,
+		logger:    logger.With().Str("component", "enrichment_worker").Logger(),
+	}, nil
+}
+
+// Start запускает воркеры, которые работают до отмены ctx. Wait дожидается их завершения
+func (w *EnrichmentWorker) Start(ctx context.Context) {
+	w.logger.Info().Int("workers", w.cfg.Workers).Msg("starting enrichment workers")
+
+	for i := 0; i < w.cfg.Workers; i++ {
+		w.wg.Add(1)
+		go func(id int) {
+			defer w.wg.Done()
+			log := w.logger.With().Int("worker_id", id).Logger()
+			w.loop(log.WithContext(ctx), log)
+		}(i)
+	}
+}
+
+func (w *EnrichmentWorker) Wait() {
+	w.wg.Wait()
+	w.logger.Info().Msg("enrichment workers stopped")
+}
+
+func (w *EnrichmentWorker) loop(ctx context.Context, log zerolog.Logger) {
+	for {
+		jobs, err := w.jobRepo.Claim(ctx, w.cfg.BatchSize, w.cfg.Lease)
+		if err != nil && ctx.Err() == nil {
+			log.Error().Err(err).Msg("failed to claim enrichment jobs")
+		}
+
+		if len(jobs) > 0 {
+			w.enrichSvc.ProcessJobs(ctx, jobs)
+			if len(jobs) == w.cfg.BatchSize {
+				// очередь, вероятно, не пуста - сразу берем следующую порцию
+				continue
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(w.cfg.PollInterval):
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package worker
+
+import (
+	"context"
+	"effective-mobile-test-task/internal/apperror"
+	"effective-mobile-test-task/internal/enricher"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+type OfflineStatsWorkerConfig struct {
+	Interval time.Duration
+}
+
+func (c *OfflineStatsWorkerConfig) Validate() error {
+	if c.Interval <= 0 {
+		c.Interval = time.Hour
+	}
+	return nil
+}
+
+// OfflineStatsWorker периодически перезагружает статистику офлайн-источника, чтобы в ней
+// учитывались пользователи, созданные или исправленные после запуска
+type OfflineStatsWorker struct {
+	cfg     OfflineStatsWorkerConfig
+	offline *enricher.OfflineEnricher
+	logger  zerolog.Logger
+	wg      sync.WaitGroup
+}
+
+func NewOfflineStatsWorker(cfg OfflineStatsWorkerConfig, offline *enricher.OfflineEnricher, logger zerolog.Logger) (*OfflineStatsWorker, error) {
+	methodName := "NewOfflineStatsWorker"
+
+	if err := cfg.Validate(); err != nil {
+		return nil, apperror.NewAppError(methodName, "invalid worker config", err)
+	}
+	if offline == nil {
+		return nil, apperror.NewAppError(methodName, "offline enricher is required", nil)
+	}
+
+	return &OfflineStatsWorker{
+		cfg:     cfg,
+		offline: offline,
+		logger:  logger.With().Str("component", "offline_stats_worker").Logger(),
+	}, nil
+}
+
+// Start запускает воркер, который работает до отмены ctx. Wait дожидается его завершения
+func (w *OfflineStatsWorker) Start(ctx context.Context) {
+	w.logger.Info().Dur("interval", w.cfg.Interval).Msg("starting offline stats worker")
+
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		w.loop(w.logger.WithContext(ctx))
+	}()
+}
+
+func (w *OfflineStatsWorker) Wait() {
+	w.wg.Wait()
+	w.logger.Info().Msg("offline stats worker stopped")
+}
+
+// loop начинает с ожидания: статистика уже загружена при создании источника
+func (w *OfflineStatsWorker) loop(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(w.cfg.Interval):
+		}
+
+		if err := w.offline.Reload(ctx); err != nil {
+			if ctx.Err() == nil {
+				w.logger.Error().Err(err).Msg("failed to reload offline statistics")
+			}
+			continue
+		}
+		w.logger.Info().Int("names", w.offline.Len()).Msg("offline statistics reloaded")
+	}
+}
@@ -0,0 +1,133 @@
+package worker
+
+import (
+	"context"
+	"effective-mobile-test-task/internal/apperror"
+	"effective-mobile-test-task/internal/repository"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+type PurgeWorkerConfig struct {
+	// Retention срок хранения мягко удаленных пользователей до окончательного удаления
+	Retention time.Duration
+	Interval  time.Duration
+	BatchSize int
+}
+
+func (c *PurgeWorkerConfig) Validate() error {
+	if c.Retention <= 0 {
+		c.Retention = 30 * 24 * time.Hour
+	}
+	if c.Interval <= 0 {
+		c.Interval = time.Hour
+	}
+	if c.BatchSize <= 0 {
+		c.BatchSize = 1000
+	}
+	return nil
+}
+
+// PurgeWorker периодически окончательно удаляет пользователей, удаленных раньше срока хранения,
+// и истекшие ключи идемпотентности
+type PurgeWorker struct {
+	cfg             PurgeWorkerConfig
+	userRepo        repository.UserRepo
+	idempotencyRepo repository.IdempotencyRepo
+	logger          zerolog.Logger
+	wg              sync.WaitGroup
+}
+
+func NewPurgeWorker(cfg PurgeWorkerConfig, userRepo repository.UserRepo, idempotencyRepo repository.IdempotencyRepo, logger zerolog.Logger) (*PurgeWorker, error) {
+	methodName := "NewPurgeWorker"
+
+	if err := cfg.Validate(); err != nil {
+		return nil, apperror.NewAppError(methodName, "invalid worker config", err)
+	}
+	if userRepo == nil {
+		return nil, apperror.NewAppError(methodName, "userRepo is required", nil)
+	}
+	if idempotencyRepo == nil {
+		return nil, apperror.NewAppError(methodName, "idempotencyRepo is required", nil)
+	}
+
+	return &PurgeWorker{
+		cfg:             cfg,
+		userRepo:        userRepo,
+		idempotencyRepo: idempotencyRepo,
+		logger:          logger.With().Str("component", "purge_worker").Logger(),
+	}, nil
+}
+
+// Start запускает воркер, который работает до отмены ctx. Wait дожидается его завершения
+func (w *PurgeWorker) Start(ctx context.Context) {
+	w.logger.Info().Dur("retention", w.cfg.Retention).Dur("interval", w.cfg.Interval).Msg("starting purge worker")
+
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		w.loop(w.logger.WithContext(ctx))
+	}()
+}
+
+func (w *PurgeWorker) Wait() {
+	w.wg.Wait()
+	w.logger.Info().Msg("purge worker stopped")
+}
+
+func (w *PurgeWorker) loop(ctx context.Context) {
+	for {
+		w.purge(ctx)
+		w.purgeIdempotencyKeys(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(w.cfg.Interval):
+		}
+	}
+}
+
+func (w *PurgeWorker) purge(ctx context.Context) {
+	var total int64
+	for ctx.Err() == nil {
+		purged, err := w.userRepo.PurgeDeleted(ctx, w.cfg.Retention, w.cfg.BatchSize)
+		if err != nil {
+			if ctx.Err() == nil {
+				w.logger.Error().Err(err).Msg("failed to purge deleted users")
+			}
+			return
+		}
+		total += purged
+		if purged < int64(w.cfg.BatchSize) {
+			break
+		}
+	}
+
+	if total > 0 {
+		w.logger.Info().Int64("purged", total).Dur("retention", w.cfg.Retention).Msg("deleted users purged")
+	}
+}
+
+func (w *PurgeWorker) purgeIdempotencyKeys(ctx context.Context) {
+	var total int64
+	for ctx.Err() == nil {
+		deleted, err := w.idempotencyRepo.DeleteExpired(ctx, w.cfg.BatchSize)
+		if err != nil {
+			if ctx.Err() == nil {
+				w.logger.Error().Err(err).Msg("failed to delete expired idempotency keys")
+			}
+			return
+		}
+		total += deleted
+		if deleted < int64(w.cfg.BatchSize) {
+			break
+		}
+	}
+
+	if total > 0 {
+		w.logger.Info().Int64("deleted", total).Msg("expired idempotency keys deleted")
+	}
+}
@@ -0,0 +1,11 @@
+-- +goose Up
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX IF NOT EXISTS idx_users_name_trgm ON users USING GIN (name gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_users_surname_trgm ON users USING GIN (surname gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_users_patronymic_trgm ON users USING GIN (patronymic gin_trgm_ops);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_users_name_trgm;
+DROP INDEX IF EXISTS idx_users_surname_trgm;
+DROP INDEX IF EXISTS idx_users_patronymic_trgm;
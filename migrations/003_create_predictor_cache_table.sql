@@ -0,0 +1,17 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS predictor_cache (
+    api VARCHAR(32) NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    response JSONB NOT NULL,
+    known BOOLEAN NOT NULL,
+    expires_at TIMESTAMP WITHOUT TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITHOUT TIME ZONE DEFAULT NOW() NOT NULL,
+    updated_at TIMESTAMP WITHOUT TIME ZONE DEFAULT NOW() NOT NULL,
+    PRIMARY KEY (api, name)
+);
+
+CREATE INDEX IF NOT EXISTS idx_predictor_cache_expires_at ON predictor_cache (expires_at);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_predictor_cache_expires_at;
+DROP TABLE IF EXISTS predictor_cache;
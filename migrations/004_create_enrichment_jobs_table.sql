@@ -0,0 +1,30 @@
+-- +goose Up
+ALTER TABLE users ADD COLUMN IF NOT EXISTS enrichment_status VARCHAR(16) DEFAULT 'pending' NOT NULL;
+
+UPDATE users
+SET enrichment_status = CASE
+    WHEN age IS NULL OR gender IS NULL OR country_id IS NULL THEN 'incomplete'
+    ELSE 'done'
+END;
+
+CREATE INDEX IF NOT EXISTS idx_users_enrichment_status ON users (enrichment_status);
+
+CREATE TABLE IF NOT EXISTS enrichment_jobs (
+    id BIGSERIAL PRIMARY KEY,
+    user_uuid VARCHAR(36) NOT NULL REFERENCES users (uuid) ON DELETE CASCADE,
+    bypass_cache BOOLEAN DEFAULT FALSE NOT NULL,
+    attempts INT DEFAULT 0 NOT NULL,
+    last_error TEXT DEFAULT NULL,
+    run_at TIMESTAMP WITHOUT TIME ZONE DEFAULT NOW() NOT NULL,
+    created_at TIMESTAMP WITHOUT TIME ZONE DEFAULT NOW() NOT NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_enrichment_jobs_user_uuid ON enrichment_jobs (user_uuid);
+CREATE INDEX IF NOT EXISTS idx_enrichment_jobs_run_at ON enrichment_jobs (run_at);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_enrichment_jobs_run_at;
+DROP INDEX IF EXISTS idx_enrichment_jobs_user_uuid;
+DROP TABLE IF EXISTS enrichment_jobs;
+DROP INDEX IF EXISTS idx_users_enrichment_status;
+ALTER TABLE users DROP COLUMN IF EXISTS enrichment_status;
@@ -0,0 +1,32 @@
+-- +goose Up
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS age_count INT DEFAULT NULL,
+    ADD COLUMN IF NOT EXISTS gender_probability REAL DEFAULT NULL,
+    ADD COLUMN IF NOT EXISTS gender_count INT DEFAULT NULL,
+    ADD COLUMN IF NOT EXISTS country_probability REAL DEFAULT NULL,
+    ADD COLUMN IF NOT EXISTS country_count INT DEFAULT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_users_gender_probability ON users (gender_probability);
+CREATE INDEX IF NOT EXISTS idx_users_country_probability ON users (country_probability);
+
+CREATE TABLE IF NOT EXISTS user_countries (
+    user_uuid VARCHAR(36) NOT NULL REFERENCES users (uuid) ON DELETE CASCADE,
+    country_id VARCHAR(2) NOT NULL,
+    probability REAL NOT NULL,
+    position SMALLINT NOT NULL,
+    PRIMARY KEY (user_uuid, country_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_countries_country_id ON user_countries (country_id);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_user_countries_country_id;
+DROP TABLE IF EXISTS user_countries;
+DROP INDEX IF EXISTS idx_users_country_probability;
+DROP INDEX IF EXISTS idx_users_gender_probability;
+ALTER TABLE users
+    DROP COLUMN IF EXISTS age_count,
+    DROP COLUMN IF EXISTS gender_probability,
+    DROP COLUMN IF EXISTS gender_count,
+    DROP COLUMN IF EXISTS country_probability,
+    DROP COLUMN IF EXISTS country_count;
@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE users ADD COLUMN IF NOT EXISTS review_reasons JSONB DEFAULT '{}'::jsonb NOT NULL;
+
+-- +goose Down
+ALTER TABLE users DROP COLUMN IF EXISTS review_reasons;
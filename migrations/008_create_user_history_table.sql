@@ -0,0 +1,60 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS user_history (
+    id BIGSERIAL PRIMARY KEY,
+    user_uuid VARCHAR(36) NOT NULL,
+    operation VARCHAR(6) NOT NULL,
+    old_values JSONB DEFAULT NULL,
+    new_values JSONB DEFAULT NULL,
+    request_id VARCHAR(64) DEFAULT NULL,
+    changed_at TIMESTAMP WITHOUT TIME ZONE DEFAULT NOW() NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_history_user_uuid ON user_history (user_uuid, id);
+
+-- app.request_id задается приложением через set_config в транзакции изменения.
+-- Для UPDATE сохраняются только изменившиеся колонки, updated_at не учитывается
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION log_user_history()
+RETURNS TRIGGER AS $$
+DECLARE
+    target_uuid VARCHAR(36);
+    old_values JSONB;
+    new_values JSONB;
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        target_uuid = NEW.uuid;
+        new_values = to_jsonb(NEW) - 'created_at' - 'updated_at';
+    ELSIF TG_OP = 'DELETE' THEN
+        target_uuid = OLD.uuid;
+        old_values = to_jsonb(OLD) - 'created_at' - 'updated_at';
+    ELSE
+        target_uuid = NEW.uuid;
+        SELECT jsonb_object_agg(o.key, o.value), jsonb_object_agg(n.key, n.value)
+        INTO old_values, new_values
+        FROM jsonb_each(to_jsonb(OLD)) o
+        JOIN jsonb_each(to_jsonb(NEW)) n ON n.key = o.key
+        WHERE n.value IS DISTINCT FROM o.value AND n.key <> 'updated_at';
+
+        IF new_values IS NULL THEN
+            RETURN NULL;
+        END IF;
+    END IF;
+
+    INSERT INTO user_history (user_uuid, operation, old_values, new_values, request_id)
+    VALUES (target_uuid, TG_OP, old_values, new_values, NULLIF(current_setting('app.request_id', true), ''));
+
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER log_user_history_trigger
+AFTER INSERT OR UPDATE OR DELETE ON users
+FOR EACH ROW
+EXECUTE FUNCTION log_user_history();
+
+-- +goose Down
+DROP TRIGGER IF EXISTS log_user_history_trigger ON users;
+DROP FUNCTION IF EXISTS log_user_history();
+DROP INDEX IF EXISTS idx_user_history_user_uuid;
+DROP TABLE IF EXISTS user_history;
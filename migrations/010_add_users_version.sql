@@ -0,0 +1,22 @@
+-- +goose Up
+ALTER TABLE users ADD COLUMN IF NOT EXISTS version BIGINT DEFAULT 1 NOT NULL;
+
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION increment_version()
+RETURNS TRIGGER AS $$
+BEGIN
+    NEW.version = OLD.version + 1;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER increment_version_trigger
+BEFORE UPDATE ON users
+FOR EACH ROW
+EXECUTE FUNCTION increment_version();
+
+-- +goose Down
+DROP TRIGGER IF EXISTS increment_version_trigger ON users;
+DROP FUNCTION IF EXISTS increment_version();
+ALTER TABLE users DROP COLUMN IF EXISTS version;
@@ -0,0 +1,47 @@
+-- +goose Up
+-- Транслитерация может удлинить имя в несколько раз (щ -> shch), поэтому TEXT
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS name_latin TEXT DEFAULT NULL,
+    ADD COLUMN IF NOT EXISTS surname_latin TEXT DEFAULT NULL,
+    ADD COLUMN IF NOT EXISTS patronymic_latin TEXT DEFAULT NULL;
+
+-- Транслитерация существующих пользователей по ICAO Doc 9303, как в normalize.Transliterate
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION transliterate_icao(value TEXT)
+RETURNS TEXT AS $$
+BEGIN
+    RETURN translate(
+        replace(replace(replace(replace(replace(replace(replace(replace(replace(
+        replace(replace(replace(replace(replace(replace(replace(replace(replace(value,
+            'ж', 'zh'), 'х', 'kh'), 'ц', 'ts'), 'ч', 'ch'), 'ш', 'sh'), 'щ', 'shch'), 'ъ', 'ie'), 'ю', 'iu'), 'я', 'ia'),
+            'Ж', 'Zh'), 'Х', 'Kh'), 'Ц', 'Ts'), 'Ч', 'Ch'), 'Ш', 'Sh'), 'Щ', 'Shch'), 'Ъ', 'Ie'), 'Ю', 'Iu'), 'Я', 'Ia'),
+        'абвгдеёзийклмнопрстуфыэАБВГДЕЁЗИЙКЛМНОПРСТУФЫЭьЬ',
+        'abvgdeeziiklmnoprstufyeABVGDEEZIIKLMNOPRSTUFYE'
+    );
+END;
+$$ LANGUAGE plpgsql IMMUTABLE;
+-- +goose StatementEnd
+
+UPDATE users
+SET name_latin = transliterate_icao(name),
+    surname_latin = transliterate_icao(surname),
+    patronymic_latin = transliterate_icao(patronymic);
+
+DROP FUNCTION IF EXISTS transliterate_icao(TEXT);
+
+CREATE INDEX IF NOT EXISTS idx_users_name_latin ON users (name_latin);
+CREATE INDEX IF NOT EXISTS idx_users_surname_latin ON users (surname_latin);
+CREATE INDEX IF NOT EXISTS idx_users_name_latin_trgm ON users USING GIN (name_latin gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_users_surname_latin_trgm ON users USING GIN (surname_latin gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_users_patronymic_latin_trgm ON users USING GIN (patronymic_latin gin_trgm_ops);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_users_patronymic_latin_trgm;
+DROP INDEX IF EXISTS idx_users_surname_latin_trgm;
+DROP INDEX IF EXISTS idx_users_name_latin_trgm;
+DROP INDEX IF EXISTS idx_users_surname_latin;
+DROP INDEX IF EXISTS idx_users_name_latin;
+ALTER TABLE users
+    DROP COLUMN IF EXISTS name_latin,
+    DROP COLUMN IF EXISTS surname_latin,
+    DROP COLUMN IF EXISTS patronymic_latin;
@@ -0,0 +1,10 @@
+-- +goose Up
+-- duplicate_of связывает пользователя с найденным при создании дубликатом,
+-- а после слияния указывает на пользователя, в которого он был влит
+ALTER TABLE users ADD COLUMN IF NOT EXISTS duplicate_of VARCHAR(36) DEFAULT NULL REFERENCES users (uuid) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_users_duplicate_of ON users (duplicate_of) WHERE duplicate_of IS NOT NULL;
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_users_duplicate_of;
+ALTER TABLE users DROP COLUMN IF EXISTS duplicate_of;